@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"web-frame"
+)
+
+const instrumentationName = "web-frame/client"
+
+var (
+	ErrCircuitOpen       = errors.New("client: 熔断器已打开")
+	errBodyNotRewindable = errors.New("client: 请求体无法重放")
+)
+
+type BackoffFunc func(attempt int) time.Duration
+
+type ClientOption func(c *Client)
+
+// Client 封装 http.Client，负责 trace 和请求 ID 的透传、重试以及熔断
+type Client struct {
+	client          *http.Client
+	timeout         time.Duration
+	tracer          trace.Tracer
+	propagator      propagation.TextMapPropagator
+	requestIDHeader string
+	maxRetries      int
+	backoff         BackoffFunc
+	breaker         *circuitBreaker
+}
+
+func NewClient(opts ...ClientOption) *Client {
+	res := &Client{
+		client:          &http.Client{},
+		tracer:          otel.GetTracerProvider().Tracer(instrumentationName),
+		propagator:      propagation.TraceContext{},
+		requestIDHeader: "X-Request-Id",
+		backoff:         ExponentialBackoff(time.Millisecond*100, time.Second*2),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	if res.timeout > 0 {
+		// 复制一份再修改，避免影响传入的 http.Client，例如 http.DefaultClient
+		client := *res.client
+		client.Timeout = res.timeout
+		res.client = &client
+	}
+	return res
+}
+
+func ClientWithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+func ClientWithTracer(tracer trace.Tracer) ClientOption {
+	return func(c *Client) {
+		c.tracer = tracer
+	}
+}
+
+func ClientWithPropagator(propagator propagation.TextMapPropagator) ClientOption {
+	return func(c *Client) {
+		c.propagator = propagator
+	}
+}
+
+func ClientWithRequestIDHeader(header string) ClientOption {
+	return func(c *Client) {
+		c.requestIDHeader = header
+	}
+}
+
+// ClientWithTimeout 设置每一次尝试的超时时间，包括读取响应体。
+// 不会修改 ClientWithHTTPClient 传入的 http.Client，和选项的顺序无关
+func ClientWithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// ClientWithRetry 对幂等请求在网络错误和 502、503、504 时重试
+func ClientWithRetry(maxRetries int, backoff BackoffFunc) ClientOption {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		if backoff != nil {
+			c.backoff = backoff
+		}
+	}
+}
+
+// ClientWithCircuitBreaker 连续失败 threshold 次后熔断 cooldown 时间，之后放行一个探测请求
+func ClientWithCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(c *Client) {
+		c.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// ExponentialBackoff 返回带抖动的指数退避
+func ExponentialBackoff(base time.Duration, maxDelay time.Duration) BackoffFunc {
+	return func(attempt int) time.Duration {
+		d := base << attempt
+		if d <= 0 || d > maxDelay {
+			d = maxDelay
+		}
+		return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+}
+
+// Do 发送请求。ctx 不为 nil 时，使用当前请求的 span 作为父 span，并透传请求 ID。
+// 超时和取消仍然由 req 自己的 context 决定
+func (c *Client) Do(ctx *web_frame.Context, req *http.Request) (*http.Response, error) {
+	var requestID string
+	if ctx != nil {
+		parent := trace.SpanContextFromContext(ctx.Req.Context())
+		if parent.IsValid() {
+			req = req.WithContext(trace.ContextWithSpanContext(req.Context(), parent))
+		}
+		requestID = ctx.RequestID
+	}
+
+	for attempt := 0; ; attempt++ {
+		if c.breaker != nil && !c.breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+		resp, err := c.do(req, requestID, attempt)
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		if c.breaker != nil {
+			c.breaker.record(!failed)
+		}
+		if !c.shouldRetry(req, resp, err, attempt) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+func (c *Client) do(req *http.Request, requestID string, attempt int) (*http.Response, error) {
+	reqCtx, span := c.tracer.Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		))
+	defer span.End()
+	if attempt > 0 {
+		span.SetAttributes(semconv.HTTPResendCount(attempt))
+	}
+	if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+		span.SetAttributes(semconv.ServerPort(port))
+	}
+
+	r := req.Clone(reqCtx)
+	if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errBodyNotRewindable
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	if requestID != "" && r.Header.Get(c.requestIDHeader) == "" {
+		r.Header.Set(c.requestIDHeader, requestID)
+	}
+	c.propagator.Inject(reqCtx, propagation.HeaderCarrier(r.Header))
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+func (c *Client) shouldRetry(req *http.Request, resp *http.Response, err error, attempt int) bool {
+	if attempt >= c.maxRetries || !idempotent(req.Method) {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, errBodyNotRewindable) {
+			return false
+		}
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func (c *Client) Get(ctx *web_frame.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("client: 构造请求失败 %w", err)
+	}
+	return c.Do(ctx, req)
+}
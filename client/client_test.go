@@ -0,0 +1,221 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"web-frame"
+	"web-frame/middlewares/opentelemetry"
+	"web-frame/middlewares/requestid"
+)
+
+func noBackoff(attempt int) time.Duration {
+	return 0
+}
+
+func TestClient_Propagation(t *testing.T) {
+	var gotTraceparent, gotRequestID string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get("traceparent")
+		gotRequestID = r.Header.Get("X-Request-Id")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer downstream.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	c := NewClient(ClientWithTracer(tp.Tracer(instrumentationName)))
+
+	otelBuilder := &opentelemetry.MiddlewareBuilder{
+		Tracer:     tp.Tracer("server"),
+		Propagator: propagation.TraceContext{},
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(
+		otelBuilder.Build(), requestid.MiddlewareBuilder{}.Build()))
+	server.Get("/proxy", func(ctx *web_frame.Context) {
+		resp, err := c.Get(ctx, downstream.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		ctx.RespData, _ = io.ReadAll(resp.Body)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+
+	assert.Equal(t, "ok", resp.Body.String())
+	assert.Equal(t, "req-1", gotRequestID)
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	clientSpan, serverSpan := spans[0], spans[1]
+	assert.Equal(t, serverSpan.SpanContext().TraceID(), clientSpan.SpanContext().TraceID())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), clientSpan.Parent().SpanID())
+	assert.Contains(t, gotTraceparent, clientSpan.SpanContext().SpanID().String())
+}
+
+func TestClient_Retry(t *testing.T) {
+	testCases := []struct {
+		name      string
+		method    string
+		body      io.Reader
+		failures  int32
+		retries   int
+		wantCode  int
+		wantCalls int32
+	}{
+		{
+			name:      "retry until success",
+			method:    http.MethodGet,
+			failures:  2,
+			retries:   3,
+			wantCode:  http.StatusOK,
+			wantCalls: 3,
+		},
+		{
+			name:      "retries exhausted",
+			method:    http.MethodGet,
+			failures:  5,
+			retries:   2,
+			wantCode:  http.StatusServiceUnavailable,
+			wantCalls: 3,
+		},
+		{
+			name:      "replay body",
+			method:    http.MethodPut,
+			body:      bytes.NewReader([]byte("hello")),
+			failures:  1,
+			retries:   1,
+			wantCode:  http.StatusOK,
+			wantCalls: 2,
+		},
+		{
+			name:      "post is not retried",
+			method:    http.MethodPost,
+			failures:  1,
+			retries:   3,
+			wantCode:  http.StatusServiceUnavailable,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				if tc.body != nil {
+					body, _ := io.ReadAll(r.Body)
+					assert.Equal(t, "hello", string(body))
+				}
+				if n <= tc.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer downstream.Close()
+
+			c := NewClient(ClientWithRetry(tc.retries, noBackoff))
+			req, err := http.NewRequest(tc.method, downstream.URL, tc.body)
+			require.NoError(t, err)
+			resp, err := c.Do(nil, req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, tc.wantCode, resp.StatusCode)
+			assert.Equal(t, tc.wantCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+	}))
+	defer downstream.Close()
+
+	c := NewClient(ClientWithTimeout(time.Millisecond * 50))
+	_, err := c.Get(nil, downstream.URL)
+	assert.Error(t, err)
+}
+
+func TestClient_TimeoutOption(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+	}))
+	defer downstream.Close()
+
+	// 选项的顺序不影响超时，也不会修改传入的 http.DefaultClient
+	c := NewClient(ClientWithTimeout(time.Millisecond*50), ClientWithHTTPClient(http.DefaultClient))
+	_, err := c.Get(nil, downstream.URL)
+	assert.Error(t, err)
+	assert.Equal(t, time.Duration(0), http.DefaultClient.Timeout)
+}
+
+func TestClient_RequestContext(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+	}))
+	defer downstream.Close()
+
+	c := NewClient()
+	server := web_frame.NewHTTPServer()
+	var err error
+	server.Get("/proxy", func(ctx *web_frame.Context) {
+		reqCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, downstream.URL, nil)
+		_, err = c.Do(ctx, req)
+	})
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	var calls int32
+	var healthy atomic.Bool
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer downstream.Close()
+
+	c := NewClient(ClientWithCircuitBreaker(2, time.Minute))
+	now := time.Now()
+	c.breaker.now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(nil, downstream.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	_, err := c.Get(nil, downstream.URL)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// 冷却结束后放行探测请求，成功后关闭熔断
+	now = now.Add(time.Minute)
+	healthy.Store(true)
+	resp, err := c.Get(nil, downstream.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	resp, err = c.Get(nil, downstream.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
@@ -3,6 +3,8 @@ package web_frame
 import (
 	"encoding/json"
 	"errors"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"net/http"
 	"net/url"
 )
@@ -20,11 +22,37 @@ type Context struct {
 
 	MatchedRoute string
 
+	RequestID string
+
 	tplEngine TemplateEngine
 
+	logger *slog.Logger
+
 	UserValues map[string]any
 }
 
+// Logger 返回带有路由、请求 ID 和 trace ID 的请求级日志
+func (c *Context) Logger() *slog.Logger {
+	logger := c.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	attrs := make([]any, 0, 3)
+	if c.MatchedRoute != "" {
+		attrs = append(attrs, slog.String("route", c.MatchedRoute))
+	}
+	if c.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", c.RequestID))
+	}
+	if c.Req == nil {
+		return logger.With(attrs...)
+	}
+	if spanCtx := trace.SpanContextFromContext(c.Req.Context()); spanCtx.HasTraceID() {
+		attrs = append(attrs, slog.String("trace_id", spanCtx.TraceID().String()))
+	}
+	return logger.With(attrs...)
+}
+
 func (c *Context) Render(tplName string, data any) error {
 	var err error
 	c.RespData, err = c.tplEngine.Render(c.Req.Context(), tplName, data)
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"web-frame"
 	"web-frame/middlewares/accesslog"
 	"web-frame/middlewares/auth"
 	"web-frame/middlewares/recovery"
+	"web-frame/middlewares/requestid"
 )
 
 func main() {
@@ -13,6 +16,7 @@ func main() {
 		accesslog.NewMiddleBuilder().LogFunc(func(log string) {
 			fmt.Println(log)
 		}).Build(),
+		requestid.MiddlewareBuilder{}.Build(),
 		recovery.MiddlewareBuilder{
 			StatueCode: 500,
 			Data:       []byte("panic ..."),
@@ -24,7 +28,15 @@ func main() {
 
 	v1 := h.Group("v1")
 	{
-		adminRoute := v1.Group("admins", auth.MiddlewareBuilder{}.Build())
+		adminRoute := v1.Group("admins", auth.NewMiddlewareBuilder(&auth.BasicAuthenticator{
+			Realm: "admin",
+			Validate: func(ctx context.Context, username, password string) (*auth.Principal, error) {
+				if username != "admin" || password != "admin" {
+					return nil, errors.New("用户名或密码错误")
+				}
+				return &auth.Principal{Subject: username, Roles: []string{"admin"}}, nil
+			},
+		}).Build())
 		adminRoute.Get("", func(ctx *web_frame.Context) {
 			_, _ = ctx.Resp.Write([]byte("admins"))
 		})
@@ -1,42 +1,104 @@
 package web_frame
 
 import (
-	lru "github.com/hashicorp/golang-lru"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
 )
 
+var (
+	errorFileTooLarge       = errors.New("web: 文件超过大小限制")
+	errorUploadTooLarge     = errors.New("web: 请求超过大小限制")
+	errorFileTypeNotAllowed = errors.New("web: 不允许上传的文件类型")
+	errorFieldsTooLarge     = errors.New("web: 表单字段超过大小限制")
+	errorFileMissing        = errors.New("web: 缺少上传的文件")
+)
+
+// maxFieldsSize 是非文件字段的总大小限制，和 http.Request.ParseMultipartForm 保持一致
+const maxFieldsSize = 10 << 20
+
+// FileUpload 用 multipart.Reader 流式地读取请求，文件先写入 DstPathFunc 返回的路径所在目录中的临时文件，
+// 所有文件都校验通过之后才重命名为目标路径，失败时只删除临时文件，已经存在的目标文件不受影响。
+// 传给 DstPathFunc 的 FileHeader 只有 Filename 和 Header，Size 为 0。
+// 没有收到文件，或者设置了 FileField 但是请求中没有这个字段的文件时返回 400。
+// 请求体已经被之前的 middleware 用 ParseMultipartForm 解析过时，改为读取解析的结果
 type FileUpload struct {
+	// FileField 和 FileFields 是接收文件的字段，都为空时接收所有字段中的文件，其余字段中的文件会被拒绝
 	FileField   string
+	FileFields  []string
 	DstPathFunc func(*multipart.FileHeader) string
+	// MaxFileSize 是单个文件的大小限制，MaxTotalSize 是整个请求体的大小限制，0 表示不限制
+	MaxFileSize  int64
+	MaxTotalSize int64
+	// AllowedExts 是允许的扩展名，例如 .png，不区分大小写，为空时不限制
+	AllowedExts []string
+	// AllowedTypes 是允许的 MIME 类型，例如 image/png、image/*，
+	// 根据文件开头的内容判断，不信任客户端声明的 Content-Type，为空时不限制
+	AllowedTypes []string
+	// Checksum 计算文件的校验和，默认为 sha256
+	Checksum func() hash.Hash
+	// OnUploaded 在所有文件写入之后调用，用于返回 UploadResult，默认只返回"上传成功"
+	OnUploaded func(ctx *Context, res *UploadResult)
+}
+
+type UploadResult struct {
+	Files  []UploadedFile      `json:"files"`
+	Fields map[string][]string `json:"fields"`
+}
+
+type UploadedFile struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	Path        string `json:"-"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	// Checksum 是十六进制编码的校验和
+	Checksum string `json:"checksum"`
+	// tmpPath 是重命名之前的临时文件
+	tmpPath string
 }
 
 func (u *FileUpload) Handle() HandleFunc {
 	return func(ctx *Context) {
-		file, fileHeader, err := ctx.Req.FormFile(u.FileField)
-		if err != nil {
-			ctx.RespStatusCode = http.StatusInternalServerError
-			ctx.RespData = []byte("上传失败: " + err.Error())
-			return
+		if u.MaxTotalSize > 0 {
+			ctx.Req.Body = http.MaxBytesReader(ctx.Resp, ctx.Req.Body, u.MaxTotalSize)
+		}
+		res, err := u.receive(ctx.Req)
+		if err == nil {
+			err = u.checkMissing(res)
+		}
+		if err == nil {
+			err = res.commit()
 		}
-		defer file.Close()
-		dst := u.DstPathFunc(fileHeader)
-		dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o666)
 		if err != nil {
-			ctx.RespStatusCode = http.StatusInternalServerError
-			ctx.RespData = []byte("上传失败: " + err.Error())
+			res.discard()
+			status := uploadErrorStatus(err)
+			level := slog.LevelWarn
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			ctx.Logger().Log(ctx.Req.Context(), level, "web: 上传失败",
+				slog.Any("error", err), slog.String("path", ctx.Req.URL.Path))
+			ctx.RespStatusCode = status
+			ctx.RespData = []byte(uploadErrorMessage(status))
 			return
 		}
-		defer dstFile.Close()
-		_, err = io.CopyBuffer(dstFile, file, nil)
-		if err != nil {
-			ctx.RespStatusCode = http.StatusInternalServerError
-			ctx.RespData = []byte("上传失败: " + err.Error())
+		if u.OnUploaded != nil {
+			u.OnUploaded(ctx, res)
 			return
 		}
 		ctx.RespStatusCode = http.StatusOK
@@ -44,128 +106,274 @@ func (u *FileUpload) Handle() HandleFunc {
 	}
 }
 
-type FileDownloader struct {
-	Dir string
+func (u *FileUpload) checkMissing(res *UploadResult) error {
+	if len(res.Files) == 0 {
+		return errorFileMissing
+	}
+	if u.FileField != "" && !slices.ContainsFunc(res.Files, func(f UploadedFile) bool {
+		return f.Field == u.FileField
+	}) {
+		return errorFileMissing
+	}
+	return nil
 }
 
-func (d *FileDownloader) Handle() HandleFunc {
-	return func(ctx *Context) {
-		req, err := ctx.QueryValue("file")
-		if err != nil {
-			ctx.RespStatusCode = http.StatusBadRequest
-			ctx.RespData = []byte("找不到目标文件参数")
-			return
-		}
-		dst := filepath.Join(d.Dir, req)
-		fn := filepath.Base(dst)
-		dst, _ = filepath.Abs(dst)
-		if !strings.Contains(dst, d.Dir) {
-			ctx.RespStatusCode = http.StatusForbidden
-			ctx.RespData = []byte("无权访问")
-			return
+// commit 把临时文件重命名为目标路径。重命名中途失败时，已经重命名的文件会保留
+func (r *UploadResult) commit() error {
+	for i := range r.Files {
+		f := &r.Files[i]
+		if err := os.Rename(f.tmpPath, f.Path); err != nil {
+			return err
 		}
-		header := ctx.Resp.Header()
-		header.Set("Content-Disposition", "attachment;filename="+fn)
-		header.Set("Content-Type", "application/octet-stream")
-		header.Set("Content-Transfer-Encoding", "binary")
-		header.Set("Expires", "0")
-		header.Set("Cache-Control", "must-revalidate")
-		header.Set("Pragma", "public")
-
-		http.ServeFile(ctx.Resp, ctx.Req, dst)
+		f.tmpPath = ""
 	}
+	return nil
 }
 
-type StaticResourceHandlerOption func(handler *StaticResourceHandler)
-
-type StaticResourceHandler struct {
-	dir               string
-	cache             *lru.Cache
-	extContentTypeMap map[string]string
-	maxSize           int
+// discard 删除还没有重命名的临时文件
+func (r *UploadResult) discard() {
+	for _, f := range r.Files {
+		if f.tmpPath != "" {
+			_ = os.Remove(f.tmpPath)
+		}
+	}
 }
 
-func NewStaticResourceHandler(dir string, opts ...StaticResourceHandlerOption) (*StaticResourceHandler, error) {
-	c, err := lru.New(1000)
+// receive 依次处理每一个 part，出错时返回已经写入的临时文件，由调用者删除
+func (u *FileUpload) receive(req *http.Request) (*UploadResult, error) {
+	res := &UploadResult{Fields: map[string][]string{}}
+	if req.MultipartForm != nil {
+		return u.receiveForm(req.MultipartForm, res)
+	}
+	mr, err := req.MultipartReader()
 	if err != nil {
-		return nil, err
+		return res, err
 	}
-	res := &StaticResourceHandler{
-		dir:   dir,
-		cache: c,
-		extContentTypeMap: map[string]string{
-			"jpeg": "image/jpeg",
-			"jpe":  "image/jpeg",
-			"jpg":  "image/jpeg",
-			"png":  "image/png",
-			"pdf":  "image/pdf",
-		},
-		maxSize: 1024 * 1024 * 10,
+	fieldsSize := int64(0)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		if part.FileName() == "" {
+			data, err := io.ReadAll(io.LimitReader(part, maxFieldsSize-fieldsSize+1))
+			if err != nil {
+				return res, err
+			}
+			fieldsSize += int64(len(data))
+			if fieldsSize > maxFieldsSize {
+				return res, errorFieldsTooLarge
+			}
+			res.Fields[part.FormName()] = append(res.Fields[part.FormName()], string(data))
+			continue
+		}
+		if !u.acceptField(part.FormName()) {
+			return res, fmt.Errorf("web: 不接收字段 %s 中的文件", part.FormName())
+		}
+		if err = u.save(part.FormName(), part.FileName(), part.Header, part, res); err != nil {
+			return res, err
+		}
 	}
+}
 
-	for _, opt := range opts {
-		opt(res)
+// receiveForm 处理之前的 middleware 已经用 ParseMultipartForm 解析过的请求，
+// 例如调用过 FormValue。此时请求体已经读完，文件在内存或者临时文件中，
+// 只能在解析之后检查大小，文件按照字段名排序处理
+func (u *FileUpload) receiveForm(form *multipart.Form, res *UploadResult) (*UploadResult, error) {
+	for name, vals := range form.Value {
+		res.Fields[name] = append(res.Fields[name], vals...)
+	}
+	fields := make([]string, 0, len(form.File))
+	for name := range form.File {
+		fields = append(fields, name)
+	}
+	slices.Sort(fields)
+	total := int64(0)
+	for _, field := range fields {
+		if !u.acceptField(field) {
+			return res, fmt.Errorf("web: 不接收字段 %s 中的文件", field)
+		}
+		for _, fh := range form.File[field] {
+			total += fh.Size
+			if u.MaxTotalSize > 0 && total > u.MaxTotalSize {
+				return res, errorUploadTooLarge
+			}
+			src, err := fh.Open()
+			if err != nil {
+				return res, err
+			}
+			err = u.save(field, fh.Filename, textproto.MIMEHeader(fh.Header), src, res)
+			_ = src.Close()
+			if err != nil {
+				return res, err
+			}
+		}
 	}
-
 	return res, nil
 }
 
-func (s *StaticResourceHandler) Handle(ctx *Context) {
-	file, err := ctx.PathValue("file")
+func (u *FileUpload) acceptField(name string) bool {
+	if u.FileField == "" && len(u.FileFields) == 0 {
+		return true
+	}
+	return name == u.FileField || slices.Contains(u.FileFields, name)
+}
+
+func (u *FileUpload) save(field string, filename string, header textproto.MIMEHeader, r io.Reader, res *UploadResult) error {
+	if len(u.AllowedExts) > 0 && !slices.ContainsFunc(u.AllowedExts, func(ext string) bool {
+		return strings.EqualFold(ext, filepath.Ext(filename))
+	}) {
+		return errorFileTypeNotAllowed
+	}
+	// 读取开头的 512 个字节判断真实的类型
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if len(u.AllowedTypes) > 0 && !matchMediaType(u.AllowedTypes, contentType) {
+		return errorFileTypeNotAllowed
+	}
+
+	dst := u.DstPathFunc(&multipart.FileHeader{
+		Filename: filename,
+		Header:   header,
+	})
+	// 临时文件和目标文件在同一个目录中，保证可以直接重命名
+	dstFile, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
 	if err != nil {
-		ctx.RespStatusCode = http.StatusBadRequest
-		ctx.RespData = []byte("请求路径错误")
-		return
-	}
-	dst := filepath.Join(s.dir, file)
-	dst, _ = filepath.Abs(dst)
-	if !strings.Contains(dst, s.dir) {
-		ctx.RespStatusCode = http.StatusForbidden
-		ctx.RespData = []byte("无权访问")
-		return
-	}
-	ext := filepath.Ext(dst)[1:]
-	header := ctx.Resp.Header()
-	if data, ok := s.cache.Get(file); ok {
-		header.Set("Content-Type", s.extContentTypeMap[ext])
-		header.Set("Content-Length", strconv.Itoa(len(data.([]byte))))
-
-		ctx.RespData = data.([]byte)
-		ctx.RespStatusCode = http.StatusOK
-		return
+		return err
+	}
+	defer dstFile.Close()
+	uploaded := UploadedFile{
+		Field:       field,
+		Filename:    filename,
+		Path:        dst,
+		ContentType: contentType,
+		tmpPath:     dstFile.Name(),
 	}
-	data, err := os.ReadFile(dst)
+	// 先记录下来，后续出错时由调用者删除
+	res.Files = append(res.Files, uploaded)
+	if err = dstFile.Chmod(0o644); err != nil {
+		return err
+	}
+
+	newHash := u.Checksum
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	h := newHash()
+	var src io.Reader = io.MultiReader(bytes.NewReader(head), r)
+	if u.MaxFileSize > 0 {
+		src = io.LimitReader(src, u.MaxFileSize+1)
+	}
+	size, err := io.Copy(io.MultiWriter(dstFile, h), src)
 	if err != nil {
-		ctx.RespStatusCode = http.StatusInternalServerError
-		ctx.RespData = []byte("服务器内部错误")
-		return
+		return err
+	}
+	if u.MaxFileSize > 0 && size > u.MaxFileSize {
+		return errorFileTooLarge
 	}
-	if len(data) <= s.maxSize {
-		s.cache.Add(file, data)
+	if err = dstFile.Sync(); err != nil {
+		return err
 	}
-	header.Set("Content-Type", s.extContentTypeMap[ext])
-	header.Set("Content-Length", strconv.Itoa(len(data)))
+	uploaded.Size = size
+	uploaded.Checksum = hex.EncodeToString(h.Sum(nil))
+	res.Files[len(res.Files)-1] = uploaded
+	return nil
+}
 
-	ctx.RespData = data
-	ctx.RespStatusCode = http.StatusOK
+// matchMediaType 支持 image/* 这样的通配符
+func matchMediaType(patterns []string, contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(pattern, mediaType) {
+			return true
+		}
+	}
+	return false
 }
 
-func StaticWithMaxFileSize(maxSize int) StaticResourceHandlerOption {
-	return func(handler *StaticResourceHandler) {
-		handler.maxSize = maxSize
+func uploadErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr), errors.Is(err, errorFileTooLarge), errors.Is(err, errorFieldsTooLarge),
+		errors.Is(err, errorUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errorFileTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, http.ErrNotMultipart), errors.Is(err, http.ErrMissingBoundary),
+		errors.Is(err, errorFileMissing):
+		return http.StatusBadRequest
 	}
+	// 创建和写入文件的错误是服务端的问题，其余的错误来自解析请求体
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
 }
 
-func StaticWithCache(c *lru.Cache) StaticResourceHandlerOption {
-	return func(handler *StaticResourceHandler) {
-		handler.cache = c
+// uploadErrorMessage 返回固定的错误信息，具体的原因只写入日志
+func uploadErrorMessage(status int) string {
+	switch status {
+	case http.StatusRequestEntityTooLarge:
+		return "上传失败: 文件过大"
+	case http.StatusUnsupportedMediaType:
+		return "上传失败: 不支持的文件类型"
+	case http.StatusInternalServerError:
+		return "上传失败: 服务器内部错误"
 	}
+	return "上传失败: 无效的请求"
+}
+
+// FileDownloader 下载 Dir 目录中的文件，文件名来自查询参数 file，
+// 可以访问的路径由 Policy 决定，零值会拒绝隐藏文件和指向目录外部的符号链接
+type FileDownloader struct {
+	Dir    string
+	Policy PathPolicy
 }
 
-func StaticWithMoreExtension(extMap map[string]string) StaticResourceHandlerOption {
-	return func(handler *StaticResourceHandler) {
-		for ext, contextType := range extMap {
-			handler.extContentTypeMap[ext] = contextType
+func (d *FileDownloader) Handle() HandleFunc {
+	return func(ctx *Context) {
+		req, err := ctx.QueryValue("file")
+		if err != nil {
+			ctx.RespStatusCode = http.StatusBadRequest
+			ctx.RespData = []byte("找不到目标文件参数")
+			return
+		}
+		dst, err := d.Policy.Join(d.Dir, req)
+		if err != nil {
+			respPathError(ctx, err)
+			return
 		}
+		// 目录会被 http.ServeFile 输出为文件列表，下载时当作文件不存在
+		if info, err := os.Stat(dst); err != nil || info.IsDir() {
+			ctx.RespStatusCode = http.StatusNotFound
+			ctx.RespData = []byte("文件不存在")
+			return
+		}
+		fn := filepath.Base(dst)
+		header := ctx.Resp.Header()
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fn}))
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-Transfer-Encoding", "binary")
+		header.Set("Expires", "0")
+		header.Set("Cache-Control", "must-revalidate")
+		header.Set("Pragma", "public")
+
+		http.ServeFile(ctx.Resp, ctx.Req, dst)
 	}
 }
@@ -1,11 +1,21 @@
 package web_frame
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"html/template"
+	"io"
 	"log"
 	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -51,3 +61,316 @@ func TestStaticResourceHandler_Handle(t *testing.T) {
 
 	_ = h.Start(":8081")
 }
+
+func TestFileDownloader_Policy(t *testing.T) {
+	base := newPolicyTree(t)
+	testCases := []struct {
+		name     string
+		dir      string
+		policy   PathPolicy
+		file     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "relative dir",
+			dir:      filepath.Join("testdata", "download"),
+			file:     "myfile.txt",
+			wantCode: http.StatusOK,
+			wantBody: "测试文件",
+		},
+		{
+			name:     "traversal",
+			dir:      filepath.Join("testdata", "download"),
+			file:     "../static/my.js",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "prefix sibling",
+			dir:      base,
+			file:     "../base-evil/x.txt",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "symlink outside",
+			dir:      base,
+			file:     "link-outside",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "symlink inside",
+			dir:      base,
+			file:     "link-inside",
+			wantCode: http.StatusOK,
+			wantBody: "base/assets/app.js",
+		},
+		{
+			name:     "dotfile",
+			dir:      base,
+			file:     ".env",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "directory",
+			dir:      base,
+			file:     "assets",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "denied",
+			dir:      base,
+			policy:   PathPolicy{Deny: []string{"*.txt"}},
+			file:     "public.txt",
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHTTPServer()
+			d := &FileDownloader{Dir: tc.dir, Policy: tc.policy}
+			h.Get("/download", d.Handle())
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/download?file="+url.QueryEscape(tc.file), nil))
+			assert.Equal(t, tc.wantCode, resp.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, resp.Body.String())
+				assert.Equal(t, `attachment; filename=`+filepath.Base(tc.file), resp.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
+
+type uploadPart struct {
+	field    string
+	filename string
+	data     []byte
+}
+
+func newUploadRequest(t *testing.T, parts ...uploadPart) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		var (
+			w   io.Writer
+			err error
+		)
+		if p.filename == "" {
+			w, err = mw.CreateFormField(p.field)
+		} else {
+			w, err = mw.CreateFormFile(p.field, p.filename)
+		}
+		require.NoError(t, err)
+		_, err = w.Write(p.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestFileUpload_Handle(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+	testCases := []struct {
+		name      string
+		upload    FileUpload
+		parts     []uploadPart
+		wantCode  int
+		wantFiles []string
+	}{
+		{
+			name:   "multiple files and fields",
+			upload: FileUpload{FileFields: []string{"avatar", "docs"}},
+			parts: []uploadPart{
+				{field: "title", data: []byte("hello")},
+				{field: "avatar", filename: "a.png", data: png},
+				{field: "docs", filename: "b.txt", data: []byte("bbb")},
+				{field: "docs", filename: "c.txt", data: []byte("ccc")},
+			},
+			wantCode:  http.StatusOK,
+			wantFiles: []string{"a.png", "b.txt", "c.txt"},
+		},
+		{
+			name:   "unexpected field",
+			upload: FileUpload{FileField: "avatar"},
+			parts: []uploadPart{
+				{field: "avatar", filename: "a.png", data: png},
+				{field: "other", filename: "b.txt", data: []byte("bbb")},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "file too large",
+			upload: FileUpload{MaxFileSize: 3},
+			parts: []uploadPart{
+				{field: "docs", filename: "b.txt", data: []byte("bbb")},
+				{field: "docs", filename: "c.txt", data: []byte("cccc")},
+			},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "request too large",
+			upload: FileUpload{MaxTotalSize: 200},
+			parts: []uploadPart{
+				{field: "docs", filename: "b.txt", data: bytes.Repeat([]byte("b"), 300)},
+			},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "sniffed type",
+			upload: FileUpload{AllowedTypes: []string{"image/*"}, AllowedExts: []string{".png"}},
+			parts: []uploadPart{
+				{field: "avatar", filename: "A.PNG", data: png},
+			},
+			wantCode:  http.StatusOK,
+			wantFiles: []string{"A.PNG"},
+		},
+		{
+			name:   "fake image",
+			upload: FileUpload{AllowedTypes: []string{"image/*"}},
+			parts: []uploadPart{
+				{field: "avatar", filename: "a.png", data: png},
+				{field: "avatar", filename: "evil.png", data: []byte("<html><script></script></html>")},
+			},
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:   "extension not allowed",
+			upload: FileUpload{AllowedExts: []string{".png"}},
+			parts: []uploadPart{
+				{field: "avatar", filename: "a.exe", data: png},
+			},
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:   "missing field",
+			upload: FileUpload{FileField: "avatar", FileFields: []string{"docs"}},
+			parts: []uploadPart{
+				{field: "title", data: []byte("hello")},
+				{field: "docs", filename: "b.txt", data: []byte("bbb")},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "no file",
+			upload: FileUpload{},
+			parts: []uploadPart{
+				{field: "title", data: []byte("hello")},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tc.upload.DstPathFunc = func(header *multipart.FileHeader) string {
+				return filepath.Join(dir, header.Filename)
+			}
+			var res *UploadResult
+			tc.upload.OnUploaded = func(ctx *Context, r *UploadResult) {
+				res = r
+				ctx.RespStatusCode = http.StatusOK
+			}
+			h := NewHTTPServer()
+			h.Post("/upload", tc.upload.Handle())
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, newUploadRequest(t, tc.parts...))
+			require.Equal(t, tc.wantCode, resp.Code, resp.Body.String())
+
+			// 失败时不会留下任何文件
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			assert.ElementsMatch(t, tc.wantFiles, names)
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+
+			require.Len(t, res.Files, len(tc.wantFiles))
+			for i, f := range res.Files {
+				data, err := os.ReadFile(filepath.Join(dir, f.Filename))
+				require.NoError(t, err)
+				sum := sha256.Sum256(data)
+				assert.Equal(t, tc.wantFiles[i], f.Filename)
+				assert.Equal(t, int64(len(data)), f.Size)
+				assert.Equal(t, hex.EncodeToString(sum[:]), f.Checksum)
+			}
+		})
+	}
+}
+
+func TestFileUpload_Result(t *testing.T) {
+	dir := t.TempDir()
+	var res *UploadResult
+	fu := FileUpload{
+		DstPathFunc: func(header *multipart.FileHeader) string {
+			return filepath.Join(dir, header.Filename)
+		},
+		OnUploaded: func(ctx *Context, r *UploadResult) {
+			res = r
+			ctx.RespData = []byte("上传成功")
+		},
+	}
+	h := NewHTTPServer()
+	h.Post("/upload", fu.Handle())
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, newUploadRequest(t,
+		uploadPart{field: "title", data: []byte("hello")},
+		uploadPart{field: "tags", data: []byte("a")},
+		uploadPart{field: "tags", data: []byte("b")},
+		uploadPart{field: "doc", filename: "a.txt", data: []byte("text")},
+	))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "上传成功", resp.Body.String())
+	assert.Equal(t, map[string][]string{"title": {"hello"}, "tags": {"a", "b"}}, res.Fields)
+	require.Len(t, res.Files, 1)
+	assert.Equal(t, UploadedFile{
+		Field:       "doc",
+		Filename:    "a.txt",
+		Path:        filepath.Join(dir, "a.txt"),
+		Size:        4,
+		ContentType: "text/plain; charset=utf-8",
+		Checksum:    "982d9e3eb996f559e633f4d194def3761d909f5a3b647d1a851fead67c32c9d1",
+	}, res.Files[0])
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("a=b")))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "上传失败: 无效的请求", resp.Body.String())
+}
+
+func TestFileUpload_KeepExisting(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0o644))
+	fu := FileUpload{
+		MaxFileSize: 3,
+		DstPathFunc: func(header *multipart.FileHeader) string {
+			return filepath.Join(dir, header.Filename)
+		},
+	}
+	h := NewHTTPServer()
+	h.Post("/upload", fu.Handle())
+
+	// 上传失败时已经存在的文件保持不变，也不会留下临时文件
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, newUploadRequest(t, uploadPart{field: "doc", filename: "a.txt", data: []byte("toolarge")}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Equal(t, "上传失败: 文件过大", resp.Body.String())
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, newUploadRequest(t, uploadPart{field: "doc", filename: "a.txt", data: []byte("new")}))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "上传成功", resp.Body.String())
+	data, err = os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
@@ -1,12 +1,52 @@
 package accesslog
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"web-frame"
 )
 
+type Format int
+
+const (
+	FormatJSON Format = iota
+	FormatCombined
+	FormatLogfmt
+)
+
+const (
+	FieldTime       = "time"
+	FieldHost       = "host"
+	FieldRoute      = "route"
+	FieldHTTPMethod = "http_method"
+	FieldPath       = "path"
+	FieldStatus     = "status"
+	FieldLatency    = "latency"
+	FieldRespSize   = "resp_size"
+	FieldClientIP   = "client_ip"
+	FieldUserAgent  = "user_agent"
+	FieldReferer    = "referer"
+	FieldRequestID  = "request_id"
+	FieldTraceID    = "trace_id"
+	FieldSessionID  = "session_id"
+)
+
 type MiddlewareBuilder struct {
-	logFunc func(log string)
+	logFunc        func(log string)
+	logger         *slog.Logger
+	format         Format
+	fields         map[string]struct{}
+	trustedProxies []*net.IPNet
+	sessionIDFunc  func(ctx *web_frame.Context) string
 }
 
 func (m *MiddlewareBuilder) LogFunc(fn func(log string)) *MiddlewareBuilder {
@@ -14,31 +54,326 @@ func (m *MiddlewareBuilder) LogFunc(fn func(log string)) *MiddlewareBuilder {
 	return m
 }
 
+// Logger 使用 slog 输出结构化的访问日志，设置后 LogFunc 和 Format 不再生效
+func (m *MiddlewareBuilder) Logger(logger *slog.Logger) *MiddlewareBuilder {
+	m.logger = logger
+	return m
+}
+
+func (m *MiddlewareBuilder) Format(format Format) *MiddlewareBuilder {
+	m.format = format
+	return m
+}
+
+// Fields 只输出指定的字段，不调用时输出全部字段。FormatCombined 的格式固定，不受影响
+func (m *MiddlewareBuilder) Fields(fields ...string) *MiddlewareBuilder {
+	m.fields = make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		m.fields[f] = struct{}{}
+	}
+	return m
+}
+
+// TrustedProxies 设置可信代理的 IP 或 CIDR，只有来自可信代理的请求才会使用 X-Forwarded-For 和 X-Real-IP
+func (m *MiddlewareBuilder) TrustedProxies(proxies ...string) *MiddlewareBuilder {
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if strings.Contains(p, ":") {
+				p = p + "/128"
+			} else {
+				p = p + "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			panic(fmt.Sprintf("accesslog: 无效的代理地址 %s", p))
+		}
+		m.trustedProxies = append(m.trustedProxies, ipNet)
+	}
+	return m
+}
+
+func (m *MiddlewareBuilder) SessionIDFunc(fn func(ctx *web_frame.Context) string) *MiddlewareBuilder {
+	m.sessionIDFunc = fn
+	return m
+}
+
 func (m *MiddlewareBuilder) Build() web_frame.Middleware {
+	if m.logFunc == nil {
+		m.logFunc = func(l string) {
+			log.Println(l)
+		}
+	}
 	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
 		return func(ctx *web_frame.Context) {
+			startTime := time.Now()
+			writer := &responseWriter{ResponseWriter: ctx.Resp}
+			ctx.Resp = writer
 			defer func() {
-				l := AccessLog{
-					Host:       ctx.Req.Host,
-					Route:      ctx.MatchedRoute,
-					HTTPMethod: ctx.Req.Method,
-					Path:       ctx.Req.URL.Path,
+				l := m.newAccessLog(ctx, writer, startTime)
+				if m.logger != nil {
+					m.logger.LogAttrs(ctx.Req.Context(), l.level(), "access", l.attrs(m.allowed)...)
+					return
 				}
-				data, _ := json.Marshal(l)
-				m.logFunc(string(data))
+				m.logFunc(m.formatLog(l))
 			}()
 			next(ctx)
 		}
 	}
 }
 
+func (m *MiddlewareBuilder) newAccessLog(ctx *web_frame.Context, writer *responseWriter, startTime time.Time) AccessLog {
+	l := AccessLog{
+		Time:       startTime,
+		Host:       ctx.Req.Host,
+		Route:      ctx.MatchedRoute,
+		HTTPMethod: ctx.Req.Method,
+		Path:       ctx.Req.URL.Path,
+		Proto:      ctx.Req.Proto,
+		RequestURI: ctx.Req.RequestURI,
+		Status:     ctx.RespStatusCode,
+		Latency:    time.Since(startTime),
+		RespSize:   writer.size + len(ctx.RespData),
+		ClientIP:   m.clientIP(ctx.Req),
+		UserAgent:  ctx.Req.UserAgent(),
+		Referer:    ctx.Req.Referer(),
+		RequestID:  ctx.RequestID,
+	}
+	if l.Status == 0 {
+		l.Status = writer.status
+	}
+	if l.Status == 0 {
+		l.Status = http.StatusOK
+	}
+	if l.RequestURI == "" {
+		l.RequestURI = ctx.Req.URL.RequestURI()
+	}
+	if spanCtx := trace.SpanContextFromContext(ctx.Req.Context()); spanCtx.HasTraceID() {
+		l.TraceID = spanCtx.TraceID().String()
+	}
+	if m.sessionIDFunc != nil {
+		l.SessionID = m.sessionIDFunc(ctx)
+	}
+	return l
+}
+
+func (m *MiddlewareBuilder) clientIP(req *http.Request) string {
+	remote, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remote = req.RemoteAddr
+	}
+	if !m.isTrusted(remote) {
+		return remote
+	}
+	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+		ips := strings.Split(xff, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if ip == "" {
+				continue
+			}
+			if i == 0 || !m.isTrusted(ip) {
+				return ip
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(req.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return remote
+}
+
+func (m *MiddlewareBuilder) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range m.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MiddlewareBuilder) formatLog(l AccessLog) string {
+	switch m.format {
+	case FormatCombined:
+		return l.combined()
+	case FormatLogfmt:
+		return l.logfmt(m.allowed)
+	default:
+		return l.json(m.allowed)
+	}
+}
+
+func (m *MiddlewareBuilder) allowed(field string) bool {
+	if m.fields == nil {
+		return true
+	}
+	_, ok := m.fields[field]
+	return ok
+}
+
 func NewMiddleBuilder() *MiddlewareBuilder {
 	return &MiddlewareBuilder{}
 }
 
 type AccessLog struct {
-	Host       string `json:"host,omitempty"`
-	Route      string `json:"route,omitempty"`
-	HTTPMethod string `json:"http_method,omitempty"`
-	Path       string `json:"path,omitempty"`
+	Time       time.Time
+	Host       string
+	Route      string
+	HTTPMethod string
+	Path       string
+	Proto      string
+	RequestURI string
+	Status     int
+	Latency    time.Duration
+	RespSize   int
+	ClientIP   string
+	UserAgent  string
+	Referer    string
+	RequestID  string
+	TraceID    string
+	SessionID  string
+}
+
+type field struct {
+	key string
+	val any
+}
+
+func (l AccessLog) fields() []field {
+	return []field{
+		{key: FieldTime, val: l.Time.Format(time.RFC3339)},
+		{key: FieldHost, val: l.Host},
+		{key: FieldRoute, val: l.Route},
+		{key: FieldHTTPMethod, val: l.HTTPMethod},
+		{key: FieldPath, val: l.Path},
+		{key: FieldStatus, val: l.Status},
+		{key: FieldLatency, val: l.Latency.String()},
+		{key: FieldRespSize, val: l.RespSize},
+		{key: FieldClientIP, val: l.ClientIP},
+		{key: FieldUserAgent, val: l.UserAgent},
+		{key: FieldReferer, val: l.Referer},
+		{key: FieldRequestID, val: l.RequestID},
+		{key: FieldTraceID, val: l.TraceID},
+		{key: FieldSessionID, val: l.SessionID},
+	}
+}
+
+func (l AccessLog) level() slog.Level {
+	switch {
+	case l.Status >= http.StatusInternalServerError:
+		return slog.LevelError
+	case l.Status >= http.StatusBadRequest:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func (l AccessLog) attrs(allowed func(string) bool) []slog.Attr {
+	res := make([]slog.Attr, 0, 16)
+	for _, f := range l.fields() {
+		if !allowed(f.key) || f.val == "" {
+			continue
+		}
+		switch f.key {
+		case FieldTime:
+			// slog 会自行记录时间
+			continue
+		case FieldLatency:
+			res = append(res, slog.Duration(f.key, l.Latency))
+		default:
+			res = append(res, slog.Any(f.key, f.val))
+		}
+	}
+	return res
+}
+
+func (l AccessLog) json(allowed func(string) bool) string {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	first := true
+	for _, f := range l.fields() {
+		if !allowed(f.key) || f.val == "" {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		key, _ := json.Marshal(f.key)
+		val, _ := json.Marshal(f.val)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+func (l AccessLog) logfmt(allowed func(string) bool) string {
+	var sb strings.Builder
+	for _, f := range l.fields() {
+		if !allowed(f.key) || f.val == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(f.key)
+		sb.WriteByte('=')
+		val := fmt.Sprint(f.val)
+		if strings.ContainsAny(val, " =\"") || val == "" {
+			val = strconv.Quote(val)
+		}
+		sb.WriteString(val)
+	}
+	return sb.String()
+}
+
+// combined 输出 Apache combined 格式
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func (l AccessLog) combined() string {
+	size := "-"
+	if l.RespSize > 0 {
+		size = strconv.Itoa(l.RespSize)
+	}
+	return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s "%s" "%s"`,
+		orDash(l.ClientIP),
+		l.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		l.HTTPMethod, l.RequestURI, l.Proto,
+		l.Status, size,
+		orDash(l.Referer), orDash(l.UserAgent))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
 }
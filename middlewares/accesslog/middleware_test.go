@@ -1,25 +1,175 @@
 package accesslog
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"web-frame"
+	"web-frame/middlewares/requestid"
 )
 
 func TestMiddlewareBuilder(t *testing.T) {
+	var logs []string
 	builder := MiddlewareBuilder{}
 	mdl := builder.LogFunc(func(log string) {
-		fmt.Println(log)
+		logs = append(logs, log)
+	}).SessionIDFunc(func(ctx *web_frame.Context) string {
+		return "sess-1"
 	}).Build()
-	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(mdl))
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(mdl, requestid.MiddlewareBuilder{}.Build()))
 	server.Post("/users/:user/comments", func(ctx *web_frame.Context) {
-		fmt.Println("hello")
+		ctx.RespStatusCode = http.StatusCreated
+		ctx.RespData = []byte("hello")
 	})
 	req, err := http.NewRequest(http.MethodPost, "/users/1/comments", nil)
-	req.Host = "localhost:8080"
 	if err != nil {
 		t.Fatal(err)
 	}
-	server.ServeHTTP(nil, req)
+	req.Host = "localhost:8080"
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("X-Request-Id", "req-1")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, logs, 1)
+	var l map[string]any
+	require.NoError(t, json.Unmarshal([]byte(logs[0]), &l))
+	assert.Equal(t, "localhost:8080", l["host"])
+	assert.Equal(t, "/users/:user/comments", l["route"])
+	assert.Equal(t, float64(http.StatusCreated), l["status"])
+	assert.Equal(t, float64(5), l["resp_size"])
+	assert.Equal(t, "10.0.0.1", l["client_ip"])
+	assert.Equal(t, "test-agent", l["user_agent"])
+	assert.Equal(t, "req-1", l["request_id"])
+	assert.Equal(t, "sess-1", l["session_id"])
+	assert.NotEmpty(t, l["latency"])
+}
+
+func TestMiddlewareBuilder_Format(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder func(b *MiddlewareBuilder) *MiddlewareBuilder
+		check   func(t *testing.T, log string)
+	}{
+		{
+			name: "json with fields",
+			builder: func(b *MiddlewareBuilder) *MiddlewareBuilder {
+				return b.Fields(FieldHTTPMethod, FieldStatus)
+			},
+			check: func(t *testing.T, log string) {
+				assert.Equal(t, `{"http_method":"GET","status":404}`, log)
+			},
+		},
+		{
+			name: "logfmt",
+			builder: func(b *MiddlewareBuilder) *MiddlewareBuilder {
+				return b.Format(FormatLogfmt).Fields(FieldPath, FieldStatus, FieldUserAgent)
+			},
+			check: func(t *testing.T, log string) {
+				assert.Equal(t, `path=/missing status=404 user_agent="my agent"`, log)
+			},
+		},
+		{
+			name: "combined",
+			builder: func(b *MiddlewareBuilder) *MiddlewareBuilder {
+				return b.Format(FormatCombined)
+			},
+			check: func(t *testing.T, log string) {
+				assert.True(t, strings.HasPrefix(log, "10.0.0.1 - - ["), log)
+				assert.True(t, strings.HasSuffix(log, `"GET /missing?a=b HTTP/1.1" 404 9 "-" "my agent"`), log)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var log string
+			mdl := tc.builder(NewMiddleBuilder().LogFunc(func(l string) {
+				log = l
+			})).Build()
+			server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(mdl))
+			server.Get("/missing", func(ctx *web_frame.Context) {
+				ctx.RespStatusCode = http.StatusNotFound
+				ctx.RespData = []byte("Not Found")
+			})
+			req := httptest.NewRequest(http.MethodGet, "/missing?a=b", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("User-Agent", "my agent")
+			server.ServeHTTP(httptest.NewRecorder(), req)
+			tc.check(t, log)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Logger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mdl := NewMiddleBuilder().Logger(slog.New(slog.NewJSONHandler(buf, nil))).
+		Fields(FieldRoute, FieldStatus, FieldLatency).Build()
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(mdl))
+	server.Get("/users/:id", func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusInternalServerError
+	})
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "access", record["msg"])
+	assert.Equal(t, "/users/:id", record["route"])
+	assert.Equal(t, float64(http.StatusInternalServerError), record["status"])
+	assert.Contains(t, record, "latency")
+	assert.NotContains(t, record, "path")
+}
+
+func TestMiddlewareBuilder_ClientIP(t *testing.T) {
+	testCases := []struct {
+		name    string
+		proxies []string
+		remote  string
+		xff     string
+		realIP  string
+		wantIP  string
+	}{
+		{
+			name:   "untrusted proxy",
+			remote: "1.1.1.1:80",
+			xff:    "2.2.2.2",
+			wantIP: "1.1.1.1",
+		},
+		{
+			name:    "trusted proxy",
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.0.0.1:80",
+			xff:     "3.3.3.3, 2.2.2.2, 10.0.0.2",
+			wantIP:  "2.2.2.2",
+		},
+		{
+			name:    "trusted proxy real ip",
+			proxies: []string{"10.0.0.1"},
+			remote:  "10.0.0.1:80",
+			realIP:  "4.4.4.4",
+			wantIP:  "4.4.4.4",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewMiddleBuilder().TrustedProxies(tc.proxies...)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remote
+			if tc.xff != "" {
+				req.Header.Set("X-Forwarded-For", tc.xff)
+			}
+			if tc.realIP != "" {
+				req.Header.Set("X-Real-IP", tc.realIP)
+			}
+			assert.Equal(t, tc.wantIP, b.clientIP(req))
+		})
+	}
 }
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"web-frame"
+)
+
+type BasicAuthenticator struct {
+	Realm    string
+	Validate func(ctx context.Context, username, password string) (*Principal, error)
+}
+
+func (b *BasicAuthenticator) Authenticate(ctx *web_frame.Context) (*Principal, error) {
+	if ctx.Req.Header.Get("Authorization") == "" {
+		return nil, ErrNoCredentials
+	}
+	username, password, ok := ctx.Req.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	p, err := b.Validate(ctx.Req.Context(), username, password)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return p, nil
+}
+
+func (b *BasicAuthenticator) Challenge(err error) string {
+	return fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, b.Realm)
+}
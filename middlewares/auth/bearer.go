@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"web-frame"
+)
+
+type BearerAuthenticator struct {
+	Realm  string
+	Verify func(ctx context.Context, token string) (*Principal, error)
+}
+
+func (b *BearerAuthenticator) Authenticate(ctx *web_frame.Context) (*Principal, error) {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	p, err := b.Verify(ctx.Req.Context(), token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return p, nil
+}
+
+func (b *BearerAuthenticator) Challenge(err error) string {
+	return bearerChallenge(b.Realm, err)
+}
+
+func bearerToken(ctx *web_frame.Context) (string, bool) {
+	header := ctx.Req.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(header[len(prefix):])
+	return token, token != ""
+}
+
+// bearerDescriptions 是返回给客户端的 error_description。RFC 6750 只允许可打印的 ASCII 字符，
+// 而且内部的错误信息不应该暴露给客户端，详细的错误由中间件记录到日志中
+var bearerDescriptions = []struct {
+	err  error
+	desc string
+}{
+	{err: errTokenExpired, desc: "The access token expired"},
+	{err: errTokenNotValid, desc: "The access token is not yet valid"},
+	{err: errTokenMalformed, desc: "The access token is malformed"},
+	{err: errTokenSignature, desc: "The access token signature is invalid"},
+	{err: errUnknownKey, desc: "The access token signing key is unknown"},
+	{err: errTokenIssuer, desc: "The access token issuer is invalid"},
+	{err: errTokenAudience, desc: "The access token audience is invalid"},
+}
+
+func bearerChallenge(realm string, err error) string {
+	challenge := fmt.Sprintf(`Bearer realm=%q`, realm)
+	if err == nil {
+		return challenge
+	}
+	desc := "The access token is invalid"
+	for _, d := range bearerDescriptions {
+		if errors.Is(err, d.err) {
+			desc = d.desc
+			break
+		}
+	}
+	return challenge + fmt.Sprintf(`, error="invalid_token", error_description=%q`, desc)
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"web-frame"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+var (
+	errTokenMalformed = errors.New("token 格式错误")
+	errTokenSignature = errors.New("token 签名错误")
+	errTokenExpired   = errors.New("token 已过期")
+	errTokenNotValid  = errors.New("token 尚未生效")
+	errTokenIssuer    = errors.New("token 签发者不匹配")
+	errTokenAudience  = errors.New("token 受众不匹配")
+	errUnknownKey     = errors.New("token 密钥不存在")
+)
+
+// JWTKey 描述一个验签密钥。HS256 使用 []byte，RS256 使用 *rsa.PublicKey，ES256 使用 *ecdsa.PublicKey
+type JWTKey struct {
+	Alg string
+	Key any
+}
+
+type JWTAuthenticator struct {
+	Realm string
+	// Keys 以 kid 为键，轮换密钥时新旧密钥同时存在即可。没有 kid 的 token 使用键为 "" 的密钥
+	Keys     map[string]JWTKey
+	Issuer   string
+	Audience string
+	// Leeway 校验 exp 和 nbf 时允许的时钟偏差
+	Leeway time.Duration
+	// PrincipalFunc 从 claims 构造 Principal，默认读取 sub、roles、permissions 和 scope
+	PrincipalFunc func(claims map[string]any) (*Principal, error)
+
+	now func() time.Time
+}
+
+func (j *JWTAuthenticator) Authenticate(ctx *web_frame.Context) (*Principal, error) {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	claims, err := j.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	principalFunc := j.PrincipalFunc
+	if principalFunc == nil {
+		principalFunc = defaultPrincipal
+	}
+	p, err := principalFunc(claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return p, nil
+}
+
+func (j *JWTAuthenticator) Challenge(err error) string {
+	return bearerChallenge(j.Realm, err)
+}
+
+// Parse 校验 token 的签名和 exp、nbf、iss、aud，返回 claims
+func (j *JWTAuthenticator) Parse(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid(errTokenMalformed)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalid(errTokenMalformed)
+	}
+	key, ok := j.Keys[header.Kid]
+	if !ok {
+		return nil, invalid(errUnknownKey)
+	}
+	// 算法由密钥决定，避免 alg 混淆攻击
+	if header.Alg != key.Alg {
+		return nil, invalid(errTokenSignature)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid(errTokenMalformed)
+	}
+	if err = verifySignature(key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, invalid(err)
+	}
+	var claims map[string]any
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalid(errTokenMalformed)
+	}
+	if err = j.validateClaims(claims); err != nil {
+		return nil, invalid(err)
+	}
+	return claims, nil
+}
+
+func (j *JWTAuthenticator) validateClaims(claims map[string]any) error {
+	now := time.Now()
+	if j.now != nil {
+		now = j.now()
+	}
+	if exp, ok := numericClaim(claims, "exp"); ok && !now.Before(exp.Add(j.Leeway)) {
+		return errTokenExpired
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(j.Leeway).Before(nbf) {
+		return errTokenNotValid
+	}
+	if j.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != j.Issuer {
+			return errTokenIssuer
+		}
+	}
+	if j.Audience != "" && !containsString(stringsClaim(claims, "aud"), j.Audience) {
+		return errTokenAudience
+	}
+	return nil
+}
+
+func verifySignature(key JWTKey, signingInput string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+	switch key.Alg {
+	case AlgHS256:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return errUnknownKey
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errTokenSignature
+		}
+	case AlgRS256:
+		pub, ok := key.Key.(*rsa.PublicKey)
+		if !ok {
+			return errUnknownKey
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return errTokenSignature
+		}
+	case AlgES256:
+		pub, ok := key.Key.(*ecdsa.PublicKey)
+		if !ok {
+			return errUnknownKey
+		}
+		if len(sig) != 64 {
+			return errTokenSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errTokenSignature
+		}
+	default:
+		return errTokenSignature
+	}
+	return nil
+}
+
+func defaultPrincipal(claims map[string]any) (*Principal, error) {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("token 缺少 sub")
+	}
+	perms := stringsClaim(claims, "permissions")
+	if scope, ok := claims["scope"].(string); ok {
+		perms = append(perms, strings.Fields(scope)...)
+	}
+	return &Principal{
+		Subject:     sub,
+		Roles:       stringsClaim(claims, "roles"),
+		Permissions: perms,
+		Claims:      claims,
+	}, nil
+}
+
+func decodeSegment(seg string, val any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, val)
+}
+
+func numericClaim(claims map[string]any, name string) (time.Time, bool) {
+	val, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(val), 0), true
+}
+
+func stringsClaim(claims map[string]any, name string) []string {
+	switch val := claims[name].(type) {
+	case string:
+		return []string{val}
+	case []any:
+		res := make([]string, 0, len(val))
+		for _, v := range val {
+			if s, ok := v.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func containsString(vals []string, target string) bool {
+	for _, v := range vals {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func invalid(err error) error {
+	return fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+}
@@ -1,19 +1,85 @@
 package auth
 
-import "web-frame"
+import (
+	"errors"
+	"net/http"
+	"web-frame"
+)
+
+const principalKey = "auth.principal"
+
+var (
+	// ErrNoCredentials 请求中没有对应方式的凭证，会继续尝试下一个 Authenticator
+	ErrNoCredentials = errors.New("auth: 缺少凭证")
+	// ErrInvalidCredentials 凭证存在但校验失败
+	ErrInvalidCredentials = errors.New("auth: 凭证无效")
+)
+
+type Principal struct {
+	Subject     string
+	Roles       []string
+	Permissions []string
+	Claims      map[string]any
+}
+
+type Authenticator interface {
+	// Authenticate 没有找到该方式的凭证时返回 ErrNoCredentials
+	Authenticate(ctx *web_frame.Context) (*Principal, error)
+	// Challenge 返回 WWW-Authenticate 头部的值，err 为认证失败的原因，可能为 nil
+	Challenge(err error) string
+}
 
 type MiddlewareBuilder struct {
+	Authenticators []Authenticator
+}
+
+func NewMiddlewareBuilder(authenticators ...Authenticator) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		Authenticators: authenticators,
+	}
 }
 
 func (m MiddlewareBuilder) Build() web_frame.Middleware {
 	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
 		return func(ctx *web_frame.Context) {
-			if ctx.Req.Header.Get("token") == "" {
-				ctx.RespStatusCode = 401
+			// 没有命中路由的请求不需要认证，直接返回 404
+			if ctx.MatchedRoute == "" {
+				next(ctx)
+				return
+			}
+			for _, a := range m.Authenticators {
+				p, err := a.Authenticate(ctx)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					// 详细的原因只记录到日志，客户端只能看到 Challenge 中固定的描述
+					ctx.Logger().Warn("auth: 认证失败", "error", err)
+					ctx.Resp.Header().Add("WWW-Authenticate", a.Challenge(err))
+					ctx.RespStatusCode = http.StatusUnauthorized
+					return
+				}
+				SetPrincipal(ctx, p)
+				next(ctx)
 				return
 			}
 
-			next(ctx)
+			for _, a := range m.Authenticators {
+				ctx.Resp.Header().Add("WWW-Authenticate", a.Challenge(nil))
+			}
+			ctx.RespStatusCode = http.StatusUnauthorized
 		}
 	}
 }
+
+func SetPrincipal(ctx *web_frame.Context, p *Principal) {
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+	ctx.UserValues[principalKey] = p
+}
+
+func PrincipalFrom(ctx *web_frame.Context) (*Principal, bool) {
+	p, ok := ctx.UserValues[principalKey].(*Principal)
+	return p, ok
+}
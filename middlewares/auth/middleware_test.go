@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"web-frame"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	basic := &BasicAuthenticator{
+		Realm: "admin",
+		Validate: func(ctx context.Context, username, password string) (*Principal, error) {
+			if username == "bill" && password == "123" {
+				return &Principal{Subject: username}, nil
+			}
+			return nil, errors.New("密码错误")
+		},
+	}
+	bearer := &BearerAuthenticator{
+		Realm: "api",
+		Verify: func(ctx context.Context, token string) (*Principal, error) {
+			if token == "good" {
+				return &Principal{Subject: "service"}, nil
+			}
+			return nil, errors.New("未知 token")
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		authorization string
+		wantCode      int
+		wantSubject   string
+		wantChallenge []string
+	}{
+		{
+			name:          "basic",
+			authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("bill:123")),
+			wantCode:      http.StatusOK,
+			wantSubject:   "bill",
+		},
+		{
+			name:          "basic wrong password",
+			authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("bill:456")),
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: []string{`Basic realm="admin", charset="UTF-8"`},
+		},
+		{
+			name:          "bearer",
+			authorization: "Bearer good",
+			wantCode:      http.StatusOK,
+			wantSubject:   "service",
+		},
+		{
+			name:          "bearer invalid",
+			authorization: "Bearer bad",
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: []string{`Bearer realm="api", error="invalid_token", error_description="The access token is invalid"`},
+		},
+		{
+			name:     "no credentials",
+			wantCode: http.StatusUnauthorized,
+			wantChallenge: []string{
+				`Basic realm="admin", charset="UTF-8"`,
+				`Bearer realm="api"`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(
+				NewMiddlewareBuilder(basic, bearer).Build()))
+			var subject string
+			server.Get("/users", func(ctx *web_frame.Context) {
+				p, ok := PrincipalFrom(ctx)
+				require.True(t, ok)
+				subject = p.Subject
+				ctx.RespStatusCode = http.StatusOK
+			})
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantSubject, subject)
+			assert.Equal(t, tc.wantChallenge, recorder.Header().Values("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestMiddlewareBuilder_NotFound(t *testing.T) {
+	bearer := &BearerAuthenticator{
+		Realm: "api",
+		Verify: func(ctx context.Context, token string) (*Principal, error) {
+			return nil, errors.New("未知 token")
+		},
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(NewMiddlewareBuilder(bearer).Build()))
+	server.Get("/users", func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusOK
+	})
+
+	// 没有命中路由时返回 404，而不是要求认证
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Empty(t, recorder.Header().Values("WWW-Authenticate"))
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestJWTAuthenticator_Parse(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	j := &JWTAuthenticator{
+		Keys: map[string]JWTKey{
+			"old": {Alg: AlgHS256, Key: []byte("old-secret")},
+			"new": {Alg: AlgHS256, Key: []byte("new-secret")},
+			"rsa": {Alg: AlgRS256, Key: &rsaKey.PublicKey},
+			"ec":  {Alg: AlgES256, Key: &ecKey.PublicKey},
+		},
+		Issuer:   "web-frame",
+		Audience: "api",
+		Leeway:   time.Second * 5,
+		now: func() time.Time {
+			return now
+		},
+	}
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"sub":   "bill",
+			"iss":   "web-frame",
+			"aud":   []string{"api", "web"},
+			"exp":   now.Add(time.Minute).Unix(),
+			"nbf":   now.Add(-time.Minute).Unix(),
+			"roles": []string{"admin"},
+			"scope": "users:read users:write",
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		token   func() string
+		wantErr error
+	}{
+		{
+			name: "hs256 rotated key",
+			token: func() string {
+				return signHS256(t, "old", []byte("old-secret"), validClaims())
+			},
+		},
+		{
+			name: "hs256 current key",
+			token: func() string {
+				return signHS256(t, "new", []byte("new-secret"), validClaims())
+			},
+		},
+		{
+			name: "rs256",
+			token: func() string {
+				return signRS256(t, "rsa", rsaKey, validClaims())
+			},
+		},
+		{
+			name: "es256",
+			token: func() string {
+				return signES256(t, "ec", ecKey, validClaims())
+			},
+		},
+		{
+			name: "unknown kid",
+			token: func() string {
+				return signHS256(t, "other", []byte("new-secret"), validClaims())
+			},
+			wantErr: errUnknownKey,
+		},
+		{
+			name: "wrong secret",
+			token: func() string {
+				return signHS256(t, "new", []byte("old-secret"), validClaims())
+			},
+			wantErr: errTokenSignature,
+		},
+		{
+			name: "alg confusion",
+			token: func() string {
+				return signHS256(t, "rsa", []byte("whatever"), validClaims())
+			},
+			wantErr: errTokenSignature,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = now.Add(-time.Second * 10).Unix()
+				return signHS256(t, "new", []byte("new-secret"), claims)
+			},
+			wantErr: errTokenExpired,
+		},
+		{
+			name: "expired within leeway",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = now.Add(-time.Second).Unix()
+				return signHS256(t, "new", []byte("new-secret"), claims)
+			},
+		},
+		{
+			name: "not before",
+			token: func() string {
+				claims := validClaims()
+				claims["nbf"] = now.Add(time.Minute).Unix()
+				return signHS256(t, "new", []byte("new-secret"), claims)
+			},
+			wantErr: errTokenNotValid,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = "other"
+				return signHS256(t, "new", []byte("new-secret"), claims)
+			},
+			wantErr: errTokenIssuer,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = "web"
+				return signHS256(t, "new", []byte("new-secret"), claims)
+			},
+			wantErr: errTokenAudience,
+		},
+		{
+			name: "malformed",
+			token: func() string {
+				return "abc.def"
+			},
+			wantErr: errTokenMalformed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := j.Parse(tc.token())
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			require.NoError(t, err)
+			p, err := defaultPrincipal(claims)
+			require.NoError(t, err)
+			assert.Equal(t, "bill", p.Subject)
+			assert.Equal(t, []string{"admin"}, p.Roles)
+			assert.Equal(t, []string{"users:read", "users:write"}, p.Permissions)
+		})
+	}
+}
+
+func TestJWTAuthenticator_Challenge(t *testing.T) {
+	j := &JWTAuthenticator{
+		Realm: "api",
+		Keys: map[string]JWTKey{
+			"": {Alg: AlgHS256, Key: []byte("secret")},
+		},
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(NewMiddlewareBuilder(j).Build()))
+	server.Get("/users", func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusOK
+	})
+
+	token := signHS256(t, "", []byte("secret"), map[string]any{
+		"sub": "bill",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, `Bearer realm="api", error="invalid_token", error_description="The access token expired"`,
+		recorder.Header().Get("WWW-Authenticate"))
+}
+
+func signingInput(t *testing.T, alg, kid string, claims map[string]any) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+}
+
+func signHS256(t *testing.T, kid string, secret []byte, claims map[string]any) string {
+	input := signingInput(t, AlgHS256, kid, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, kid string, key *rsa.PrivateKey, claims map[string]any) string {
+	input := signingInput(t, AlgRS256, kid, claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func signES256(t *testing.T, kid string, key *ecdsa.PrivateKey, claims map[string]any) string {
+	input := signingInput(t, AlgES256, kid, claims)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
@@ -0,0 +1,136 @@
+package authz
+
+import (
+	"net/http"
+	"web-frame"
+	"web-frame/middlewares/auth"
+)
+
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type MiddlewareBuilder struct {
+	cfg           *Config
+	policies      map[string]Policy
+	denyByDefault bool
+}
+
+// NewMiddlewareBuilder cfg 可以为 nil，此时只根据 Principal 自身的角色和权限判断
+func NewMiddlewareBuilder(cfg *Config) *MiddlewareBuilder {
+	m := &MiddlewareBuilder{
+		cfg:      cfg,
+		policies: map[string]Policy{},
+	}
+	if cfg != nil {
+		for _, p := range cfg.Policies {
+			m.Allow(p.Method, p.Route, p.Policy)
+		}
+	}
+	return m
+}
+
+// Allow 为路由设置访问策略，route 为注册时的完整路由，例如 /v1/users/:id
+func (m *MiddlewareBuilder) Allow(method string, route string, policy Policy) *MiddlewareBuilder {
+	m.policies[method+" "+route] = policy
+	return m
+}
+
+// DenyByDefault 拒绝访问没有配置策略的路由
+func (m *MiddlewareBuilder) DenyByDefault() *MiddlewareBuilder {
+	m.denyByDefault = true
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web_frame.Middleware {
+	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
+		return func(ctx *web_frame.Context) {
+			// 没有命中路由的请求直接返回 404，不应该被 DenyByDefault 变成 403
+			if ctx.MatchedRoute == "" {
+				next(ctx)
+				return
+			}
+			policy, ok := m.policies[ctx.Req.Method+" "+ctx.MatchedRoute]
+			if !ok {
+				if m.denyByDefault {
+					forbidden(ctx)
+					return
+				}
+				next(ctx)
+				return
+			}
+			m.check(ctx, policy, next)
+		}
+	}
+}
+
+// Require 返回固定策略的中间件，用于路由组
+func (m *MiddlewareBuilder) Require(policy Policy) web_frame.Middleware {
+	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
+		return func(ctx *web_frame.Context) {
+			m.check(ctx, policy, next)
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) check(ctx *web_frame.Context, policy Policy, next web_frame.HandleFunc) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		_ = ctx.RespJson(http.StatusUnauthorized, errorBody{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		})
+		return
+	}
+	allowed, err := m.Authorize(p, policy)
+	if err != nil {
+		ctx.Logger().Error("authz: 鉴权失败", "error", err)
+	}
+	if !allowed {
+		forbidden(ctx)
+		return
+	}
+	next(ctx)
+}
+
+// Authorize 判断 Principal 是否满足策略
+func (m *MiddlewareBuilder) Authorize(p *auth.Principal, policy Policy) (bool, error) {
+	roles, err := m.cfg.expandRoles(p.Roles)
+	if err != nil {
+		return false, err
+	}
+	if len(policy.Roles) > 0 {
+		found := false
+		for _, r := range policy.Roles {
+			if _, ok := roles[r]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	granted := append(m.cfg.permissions(roles), p.Permissions...)
+	for _, required := range policy.Permissions {
+		found := false
+		for _, g := range granted {
+			if matchPermission(g, required) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func forbidden(ctx *web_frame.Context) {
+	_ = ctx.RespJson(http.StatusForbidden, errorBody{
+		Code:    http.StatusForbidden,
+		Message: "forbidden",
+	})
+}
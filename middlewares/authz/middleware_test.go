@@ -0,0 +1,169 @@
+package authz
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"web-frame"
+	"web-frame/middlewares/auth"
+)
+
+func withPrincipal(p *auth.Principal) web_frame.Middleware {
+	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
+		return func(ctx *web_frame.Context) {
+			if p != nil {
+				auth.SetPrincipal(ctx, p)
+			}
+			next(ctx)
+		}
+	}
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join("testdata", "rbac.json"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		principal *auth.Principal
+		method    string
+		path      string
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:      "viewer read",
+			principal: &auth.Principal{Subject: "a", Roles: []string{"viewer"}},
+			method:    http.MethodGet,
+			path:      "/v1/users/1",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "viewer write",
+			principal: &auth.Principal{Subject: "a", Roles: []string{"viewer"}},
+			method:    http.MethodPost,
+			path:      "/v1/users",
+			wantCode:  http.StatusForbidden,
+			wantBody:  `{"code":403,"message":"forbidden"}`,
+		},
+		{
+			name:      "editor inherits read",
+			principal: &auth.Principal{Subject: "a", Roles: []string{"editor"}},
+			method:    http.MethodGet,
+			path:      "/v1/users/1",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "direct permission",
+			principal: &auth.Principal{Subject: "a", Permissions: []string{"users:*"}},
+			method:    http.MethodPost,
+			path:      "/v1/users",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "editor delete",
+			principal: &auth.Principal{Subject: "a", Roles: []string{"editor"}},
+			method:    http.MethodDelete,
+			path:      "/v1/users/1",
+			wantCode:  http.StatusForbidden,
+			wantBody:  `{"code":403,"message":"forbidden"}`,
+		},
+		{
+			name:      "admin delete",
+			principal: &auth.Principal{Subject: "a", Roles: []string{"admin"}},
+			method:    http.MethodDelete,
+			path:      "/v1/users/1",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:     "no principal",
+			method:   http.MethodGet,
+			path:     "/v1/users/1",
+			wantCode: http.StatusUnauthorized,
+			wantBody: `{"code":401,"message":"unauthorized"}`,
+		},
+		{
+			name:      "no policy",
+			principal: &auth.Principal{Subject: "a"},
+			method:    http.MethodGet,
+			path:      "/v1/health",
+			wantCode:  http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(
+				withPrincipal(tc.principal), NewMiddlewareBuilder(cfg).Build()))
+			handler := func(ctx *web_frame.Context) {
+				ctx.RespStatusCode = http.StatusOK
+			}
+			v1 := server.Group("v1")
+			v1.Get("/users/:id", handler)
+			v1.Post("/users", handler)
+			v1.Delete("/users/:id", handler)
+			v1.Get("/health", handler)
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Require(t *testing.T) {
+	builder := NewMiddlewareBuilder(nil).DenyByDefault()
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(
+		withPrincipal(&auth.Principal{Subject: "a", Roles: []string{"ops"}})))
+	handler := func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusOK
+	}
+	server.Group("ops", builder.Require(Policy{Roles: []string{"ops"}})).Get("/status", handler)
+	server.Group("admins", builder.Require(Policy{Roles: []string{"admin"}})).Get("/status", handler)
+	server.Group("others", builder.Build()).Get("/status", handler)
+
+	testCases := []struct {
+		path     string
+		wantCode int
+	}{
+		{path: "/ops/status", wantCode: http.StatusOK},
+		{path: "/admins/status", wantCode: http.StatusForbidden},
+		{path: "/others/status", wantCode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_NotFound(t *testing.T) {
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(
+		withPrincipal(&auth.Principal{Subject: "a"}), NewMiddlewareBuilder(nil).DenyByDefault().Build()))
+	server.Get("/users/:id", func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusOK
+	})
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestLoadConfig_Cycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rbac.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"roles": {"a": {"inherits": ["b"]}, "b": {"inherits": ["a"]}}}`), 0o666))
+	_, err := LoadConfig(path)
+	assert.Error(t, err)
+}
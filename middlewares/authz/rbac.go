@@ -0,0 +1,99 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Role struct {
+	Permissions []string `json:"permissions"`
+	// Inherits 继承的角色，拥有该角色即拥有被继承角色的全部权限
+	Inherits []string `json:"inherits"`
+}
+
+// Policy 描述访问条件，Roles 满足其一即可，Permissions 需要全部满足
+type Policy struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoutePolicy struct {
+	Method string `json:"method"`
+	Route  string `json:"route"`
+	Policy
+}
+
+type Config struct {
+	Roles    map[string]Role `json:"roles"`
+	Policies []RoutePolicy   `json:"policies"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("authz: 解析配置失败 %w", err)
+	}
+	for name := range cfg.Roles {
+		if _, err = cfg.expandRoles([]string{name}); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// expandRoles 返回包括继承在内的全部角色
+func (c *Config) expandRoles(roles []string) (map[string]struct{}, error) {
+	res := make(map[string]struct{}, len(roles))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		for _, p := range path {
+			if p == name {
+				return fmt.Errorf("authz: 角色继承存在环 %s", strings.Join(append(path, name), " -> "))
+			}
+		}
+		res[name] = struct{}{}
+		if c == nil {
+			return nil
+		}
+		for _, parent := range c.Roles[name].Inherits {
+			if err := visit(parent, append(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, r := range roles {
+		if err := visit(r, nil); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (c *Config) permissions(roles map[string]struct{}) []string {
+	if c == nil {
+		return nil
+	}
+	var res []string
+	for r := range roles {
+		res = append(res, c.Roles[r].Permissions...)
+	}
+	return res
+}
+
+// matchPermission 支持 * 和 users:* 形式的通配
+func matchPermission(granted, required string) bool {
+	if granted == "*" || granted == required {
+		return true
+	}
+	if strings.HasSuffix(granted, ":*") {
+		return strings.HasPrefix(required, granted[:len(granted)-1])
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"mime"
+	"net/http"
+	"web-frame"
+	"web-frame/session"
+	"web-frame/session/cookie"
+)
+
+const (
+	DefaultHeader    = "X-CSRF-Token"
+	DefaultFieldName = "csrf_token"
+	tokenLength      = 32
+	stateKey         = "csrf.state"
+	sessionKey       = session.ReservedKeyPrefix + "csrf"
+)
+
+var errNoToken = errors.New("csrf: 没有令牌")
+
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// MiddlewareBuilder 校验非安全方法（GET、HEAD、OPTIONS、TRACE 以外）请求携带的令牌。
+// Manager 不为 nil 时使用同步令牌模式，令牌保存在 session 中；否则使用双重提交 cookie 模式，
+// 此时建议用 cookie.PropagatorWithCodec 对 cookie 签名，防止子域名写入伪造的 cookie
+type MiddlewareBuilder struct {
+	Manager *session.Manager
+	// Cookie 双重提交模式下保存令牌的 cookie，默认名字为 csrf_token
+	Cookie *cookie.Propagator
+	// Header 读取令牌的头部，默认为 X-CSRF-Token
+	Header string
+	// FieldName 头部中没有令牌时读取的表单字段，默认为 csrf_token。
+	// 只读取 application/x-www-form-urlencoded 的请求体，multipart 请求必须通过头部传递令牌，
+	// 否则需要先把整个请求体读入内存或者临时文件，上传文件时无法流式处理和限制大小
+	FieldName string
+	// ErrorHandler 处理校验失败的请求，默认返回 403
+	ErrorHandler web_frame.HandleFunc
+}
+
+func (m MiddlewareBuilder) Build() web_frame.Middleware {
+	if m.Cookie == nil {
+		m.Cookie = cookie.NewPropagator(cookie.PropagatorWithCookieName(DefaultFieldName))
+	}
+	if m.Header == "" {
+		m.Header = DefaultHeader
+	}
+	if m.FieldName == "" {
+		m.FieldName = DefaultFieldName
+	}
+	if m.ErrorHandler == nil {
+		m.ErrorHandler = func(ctx *web_frame.Context) {
+			_ = ctx.RespJson(http.StatusForbidden, errorBody{
+				Code:    http.StatusForbidden,
+				Message: "invalid csrf token",
+			})
+		}
+	}
+	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
+		return func(ctx *web_frame.Context) {
+			if ctx.UserValues == nil {
+				ctx.UserValues = make(map[string]any, 1)
+			}
+			st := &state{builder: &m, ctx: ctx}
+			ctx.UserValues[stateKey] = st
+			if safeMethod(ctx.Req.Method) {
+				next(ctx)
+				return
+			}
+			token, err := st.load()
+			if err != nil || !m.verify(ctx, token) {
+				m.ErrorHandler(ctx)
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// FuncMap 返回模板函数 csrfField，用法为 {{ csrfField .CSRFToken }}，令牌通过 Token 获取
+func (m MiddlewareBuilder) FuncMap() template.FuncMap {
+	name := m.FieldName
+	if name == "" {
+		name = DefaultFieldName
+	}
+	return template.FuncMap{
+		"csrfField": func(token string) template.HTML {
+			return hiddenInput(name, token)
+		},
+	}
+}
+
+// Token 返回当前请求可以使用的令牌，需要时才生成和保存。
+// 每次返回的值都经过随机掩码处理，可以放心地输出到页面中
+func Token(ctx *web_frame.Context) string {
+	st, ok := ctx.UserValues[stateKey].(*state)
+	if !ok {
+		return ""
+	}
+	token, err := st.load()
+	if err != nil {
+		token, err = st.create()
+		if err != nil {
+			ctx.Logger().Error("csrf: 生成令牌失败", "error", err)
+			return ""
+		}
+	}
+	return mask(token)
+}
+
+// TemplateField 返回包含令牌的隐藏表单字段
+func TemplateField(ctx *web_frame.Context) template.HTML {
+	st, ok := ctx.UserValues[stateKey].(*state)
+	if !ok {
+		return ""
+	}
+	return hiddenInput(st.builder.FieldName, Token(ctx))
+}
+
+func hiddenInput(name string, token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(name) +
+		`" value="` + template.HTMLEscapeString(token) + `"/>`)
+}
+
+func (m *MiddlewareBuilder) verify(ctx *web_frame.Context, token []byte) bool {
+	submitted := ctx.Req.Header.Get(m.Header)
+	if submitted == "" && formURLEncoded(ctx.Req) {
+		submitted = ctx.Req.FormValue(m.FieldName)
+	}
+	expected, ok := unmask(submitted)
+	return ok && subtle.ConstantTimeCompare(expected, token) == 1
+}
+
+// state 保存一次请求内的令牌，避免重复读取 session 或生成多个令牌
+type state struct {
+	builder *MiddlewareBuilder
+	ctx     *web_frame.Context
+	token   []byte
+}
+
+func (s *state) load() ([]byte, error) {
+	if s.token != nil {
+		return s.token, nil
+	}
+	var encoded string
+	if s.builder.Manager != nil {
+		sess, err := s.builder.Manager.GetSession(s.ctx)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err = session.GetAs[string](s.ctx.Req.Context(), sess, sessionKey)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		encoded, err = s.builder.Cookie.Extract(s.ctx.Req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	token, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(token) != tokenLength {
+		return nil, errNoToken
+	}
+	s.token = token
+	return token, nil
+}
+
+func (s *state) create() ([]byte, error) {
+	token := make([]byte, tokenLength)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+	if s.builder.Manager != nil {
+		sess, err := s.builder.Manager.GetSession(s.ctx)
+		if err != nil {
+			sess, err = s.builder.Manager.InitSession(s.ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err = sess.Set(s.ctx.Req.Context(), sessionKey, encoded); err != nil {
+			return nil, err
+		}
+	} else if err := s.builder.Cookie.Inject(encoded, s.ctx.Resp); err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// mask 用一次性的随机数对令牌做异或，使每次输出的值都不同，防御 BREACH 攻击
+func mask(token []byte) string {
+	otp := make([]byte, tokenLength)
+	if _, err := rand.Read(otp); err != nil {
+		return ""
+	}
+	res := make([]byte, 0, tokenLength*2)
+	res = append(res, otp...)
+	for i := range token {
+		res = append(res, token[i]^otp[i])
+	}
+	return base64.RawURLEncoding.EncodeToString(res)
+}
+
+func unmask(masked string) ([]byte, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(masked)
+	if err != nil || len(data) != tokenLength*2 {
+		return nil, false
+	}
+	otp, xored := data[:tokenLength], data[tokenLength:]
+	token := make([]byte, tokenLength)
+	for i := range token {
+		token[i] = otp[i] ^ xored[i]
+	}
+	return token, true
+}
+
+func formURLEncoded(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,200 @@
+package csrf
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"web-frame"
+	"web-frame/session"
+	"web-frame/session/cookie"
+	"web-frame/session/memory"
+)
+
+var fieldRegexp = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="([^"]+)"/>`)
+
+func newServer(t *testing.T, m MiddlewareBuilder) *web_frame.HTTPServer {
+	tpl, err := template.New("").Funcs(m.FuncMap()).ParseFiles("../../testdata/tpls/login.gohtml")
+	require.NoError(t, err)
+	mdls := []web_frame.Middleware{m.Build()}
+	if m.Manager != nil {
+		mdls = append([]web_frame.Middleware{m.Manager.Middleware()}, mdls...)
+	}
+	server := web_frame.NewHTTPServer(
+		web_frame.ServerWithTemplateEngine(&web_frame.GoTemplateEngine{T: tpl}),
+		web_frame.ServerWithMiddleware(mdls...))
+	server.Get("/login", func(ctx *web_frame.Context) {
+		_ = ctx.Render("login.gohtml", map[string]any{"CSRFField": TemplateField(ctx)})
+	})
+	server.Post("/login", func(ctx *web_frame.Context) {
+		ctx.RespData = []byte("ok")
+	})
+	return server
+}
+
+func TestMiddlewareBuilder(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder MiddlewareBuilder
+	}{
+		{
+			name: "synchronizer token",
+			builder: MiddlewareBuilder{
+				Manager: &session.Manager{
+					Propagator: cookie.NewPropagator(),
+					Store:      memory.NewStore(time.Minute),
+					CtxSessKey: "sessKey",
+				},
+			},
+		},
+		{
+			name:    "double submit cookie",
+			builder: MiddlewareBuilder{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newServer(t, tc.builder)
+
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/login", nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+			matches := fieldRegexp.FindStringSubmatch(resp.Body.String())
+			require.Len(t, matches, 2)
+			token := matches[1]
+			cookies := resp.Result().Cookies()
+			require.Len(t, cookies, 1)
+
+			post := func(form url.Values, header string, withCookie bool) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				if header != "" {
+					req.Header.Set(DefaultHeader, header)
+				}
+				if withCookie {
+					req.AddCookie(cookies[0])
+				}
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				return resp
+			}
+
+			resp = post(url.Values{"csrf_token": {token}}, "", true)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, "ok", resp.Body.String())
+
+			resp = post(url.Values{}, token, true)
+			assert.Equal(t, http.StatusOK, resp.Code)
+
+			resp = post(url.Values{}, "", true)
+			assert.Equal(t, http.StatusForbidden, resp.Code)
+			assert.JSONEq(t, `{"code":403,"message":"invalid csrf token"}`, resp.Body.String())
+
+			resp = post(url.Values{"csrf_token": {token}}, "", false)
+			assert.Equal(t, http.StatusForbidden, resp.Code)
+
+			resp = post(url.Values{"csrf_token": {"invalid"}}, "", true)
+			assert.Equal(t, http.StatusForbidden, resp.Code)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Upload(t *testing.T) {
+	dir := t.TempDir()
+	var res *web_frame.UploadResult
+	upload := web_frame.FileUpload{
+		FileField: "myfile",
+		DstPathFunc: func(header *multipart.FileHeader) string {
+			return filepath.Join(dir, header.Filename)
+		},
+		OnUploaded: func(ctx *web_frame.Context, r *web_frame.UploadResult) {
+			res = r
+		},
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(MiddlewareBuilder{}.Build()))
+	server.Get("/form", func(ctx *web_frame.Context) {
+		ctx.RespData = []byte(Token(ctx))
+	})
+	server.Post("/upload", upload.Handle())
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/form", nil))
+	token := resp.Body.String()
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	post := func(header string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		require.NoError(t, mw.WriteField(DefaultFieldName, token))
+		w, err := mw.CreateFormFile("myfile", "a.txt")
+		require.NoError(t, err)
+		_, err = w.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+		req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if header != "" {
+			req.Header.Set(DefaultHeader, header)
+		}
+		req.AddCookie(cookies[0])
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// multipart 请求中的表单字段不会被读取，否则整个请求体会在上传之前被解析
+	resp = post("")
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	_, err := os.Stat(filepath.Join(dir, "a.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	resp = post(token)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.NotNil(t, res)
+	require.Len(t, res.Files, 1)
+	assert.Equal(t, int64(5), res.Files[0].Size)
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestMask(t *testing.T) {
+	token := []byte(strings.Repeat("t", tokenLength))
+	first, second := mask(token), mask(token)
+	assert.NotEqual(t, first, second)
+	for _, masked := range []string{first, second} {
+		res, ok := unmask(masked)
+		require.True(t, ok)
+		assert.Equal(t, token, res)
+	}
+}
+
+func TestTemplateField(t *testing.T) {
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(MiddlewareBuilder{FieldName: "_csrf"}.Build()))
+	server.Get("/form", func(ctx *web_frame.Context) {
+		ctx.RespData = []byte(TemplateField(ctx))
+	})
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/form", nil))
+	assert.Regexp(t, `^<input type="hidden" name="_csrf" value="[A-Za-z0-9_-]+"/>$`, resp.Body.String())
+}
+
+func TestMiddlewareBuilder_FuncMap(t *testing.T) {
+	tpl := template.Must(template.New("form").Funcs(MiddlewareBuilder{FieldName: "_csrf"}.FuncMap()).
+		Parse(`{{ csrfField . }}`))
+	var buf strings.Builder
+	require.NoError(t, tpl.Execute(&buf, "token"))
+	assert.Equal(t, `<input type="hidden" name="_csrf" value="token"/>`, buf.String())
+}
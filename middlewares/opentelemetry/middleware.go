@@ -1,10 +1,19 @@
 package opentelemetry
 
 import (
+	"fmt"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"web-frame"
 )
 
@@ -12,32 +21,130 @@ const instrumentationName = "web-frame/middlewares/opentelemetry"
 
 type MiddlewareBuilder struct {
 	Tracer trace.Tracer
+	// Meter 默认使用全局的 MeterProvider
+	Meter metric.Meter
+	// Propagator 默认使用全局的 TextMapPropagator
+	Propagator propagation.TextMapPropagator
+	// SpanNameFormatter 在请求处理完成后计算 span 的名字，默认为 "{method} {route}"
+	SpanNameFormatter func(ctx *web_frame.Context) string
 }
 
 func (m *MiddlewareBuilder) Build() web_frame.Middleware {
 	if m.Tracer == nil {
 		m.Tracer = otel.GetTracerProvider().Tracer(instrumentationName)
 	}
+	if m.Meter == nil {
+		m.Meter = otel.GetMeterProvider().Meter(instrumentationName)
+	}
+	if m.Propagator == nil {
+		m.Propagator = otel.GetTextMapPropagator()
+	}
+	if m.SpanNameFormatter == nil {
+		m.SpanNameFormatter = defaultSpanName
+	}
+	duration, err := m.Meter.Float64Histogram("http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("HTTP 请求耗时"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	activeRequests, err := m.Meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("正在处理的 HTTP 请求数"))
+	if err != nil {
+		otel.Handle(err)
+	}
 	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
 		return func(ctx *web_frame.Context) {
+			startTime := time.Now()
 			reqCtx := ctx.Req.Context()
-			reqCtx = otel.GetTextMapPropagator().Extract(reqCtx, propagation.HeaderCarrier(ctx.Req.Header))
+			reqCtx = m.Propagator.Extract(reqCtx, propagation.HeaderCarrier(ctx.Req.Header))
+
+			reqCtx, span := m.Tracer.Start(reqCtx, ctx.Req.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(requestAttributes(ctx.Req)...))
+			m.Propagator.Inject(reqCtx, propagation.HeaderCarrier(ctx.Resp.Header()))
+			ctx.Req = ctx.Req.WithContext(reqCtx)
 
-			reqCtx, span := m.Tracer.Start(reqCtx, "unknown")
+			activeAttrs := metric.WithAttributes(semconv.HTTPRequestMethodKey.String(ctx.Req.Method))
+			activeRequests.Add(reqCtx, 1, activeAttrs)
 			defer func() {
-				span.SetName(ctx.MatchedRoute)
-				span.SetAttributes(attribute.Int("http.status", ctx.RespStatusCode))
-				span.End()
-			}()
+				activeRequests.Add(reqCtx, -1, activeAttrs)
+				status := ctx.RespStatusCode
+				if status == 0 {
+					status = http.StatusOK
+				}
+				if err := recover(); err != nil {
+					span.RecordError(fmt.Errorf("panic: %v", err), trace.WithStackTrace(true))
+					span.SetStatus(codes.Error, fmt.Sprint(err))
+					status = http.StatusInternalServerError
+					defer panic(err)
+				} else if status >= http.StatusInternalServerError {
+					span.SetStatus(codes.Error, http.StatusText(status))
+				}
 
-			span.SetAttributes(attribute.String("http.method", ctx.Req.Method))
-			span.SetAttributes(attribute.String("http.url", ctx.Req.URL.String()))
-			span.SetAttributes(attribute.String("http.scheme", ctx.Req.URL.Scheme))
-			span.SetAttributes(attribute.String("http.host", ctx.Req.Host))
+				span.SetName(m.SpanNameFormatter(ctx))
+				attrs := []attribute.KeyValue{
+					semconv.HTTPRequestMethodKey.String(ctx.Req.Method),
+					semconv.HTTPResponseStatusCode(status),
+				}
+				if ctx.MatchedRoute != "" {
+					attrs = append(attrs, semconv.HTTPRoute(ctx.MatchedRoute))
+				}
+				duration.Record(reqCtx, time.Since(startTime).Seconds(), metric.WithAttributes(attrs...))
 
-			ctx.Req = ctx.Req.WithContext(reqCtx)
+				if ctx.RequestID != "" {
+					attrs = append(attrs, attribute.String("http.request_id", ctx.RequestID))
+				}
+				attrs = append(attrs, semconv.HTTPResponseBodySize(len(ctx.RespData)))
+				span.SetAttributes(attrs...)
+				span.End()
+			}()
 
 			next(ctx)
 		}
 	}
 }
+
+func requestAttributes(req *http.Request) []attribute.KeyValue {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.URLScheme(scheme),
+		semconv.URLPath(req.URL.Path),
+	}
+	if req.URL.RawQuery != "" {
+		attrs = append(attrs, semconv.URLQuery(req.URL.RawQuery))
+	}
+	if host, port, err := net.SplitHostPort(req.Host); err == nil {
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.ServerPort(p))
+		}
+	} else if req.Host != "" {
+		attrs = append(attrs, semconv.ServerAddress(req.Host))
+	}
+	if ua := req.UserAgent(); ua != "" {
+		attrs = append(attrs, semconv.UserAgentOriginal(ua))
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		attrs = append(attrs, semconv.ClientAddress(host))
+	}
+	if req.ContentLength > 0 {
+		attrs = append(attrs, semconv.HTTPRequestBodySize(int(req.ContentLength)))
+	}
+	if proto := strings.TrimPrefix(req.Proto, "HTTP/"); proto != req.Proto {
+		attrs = append(attrs, semconv.NetworkProtocolVersion(proto))
+	}
+	return attrs
+}
+
+func defaultSpanName(ctx *web_frame.Context) string {
+	if ctx.MatchedRoute == "" {
+		return ctx.Req.Method
+	}
+	return ctx.Req.Method + " " + ctx.MatchedRoute
+}
@@ -1,18 +1,30 @@
 package opentelemetry
 
 import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/jaeger"
 	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 	"web-frame"
+	"web-frame/middlewares/requestid"
 )
 
 func TestMiddlewareBuilder_Build(t *testing.T) {
@@ -50,6 +62,123 @@ func TestMiddlewareBuilder_Build(t *testing.T) {
 	_ = server.Start(":8081")
 }
 
+func TestMiddlewareBuilder_RequestID(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	builder := MiddlewareBuilder{
+		Tracer: tp.Tracer(instrumentationName),
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(
+		builder.Build(), requestid.MiddlewareBuilder{}.Build()))
+	server.Get("/users", func(ctx *web_frame.Context) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set(requestid.DefaultHeader, "req-1")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Contains(t, spans[0].Attributes(), attribute.String("http.request_id", "req-1"))
+}
+
+func TestMiddlewareBuilder_Spans(t *testing.T) {
+	spanRecorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	builder := MiddlewareBuilder{
+		Tracer:     tp.Tracer(instrumentationName),
+		Meter:      mp.Meter(instrumentationName),
+		Propagator: propagation.TraceContext{},
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(builder.Build()))
+	server.Get("/users/:id", func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusOK
+	})
+	server.Get("/error", func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusBadGateway
+	})
+	server.Get("/panic", func(ctx *web_frame.Context) {
+		panic("boom")
+	})
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/users/1?a=b", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), parent),
+		propagation.HeaderCarrier(req.Header))
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/error", nil))
+	assert.PanicsWithValue(t, "boom", func() {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	})
+
+	spans := spanRecorder.Ended()
+	require.Len(t, spans, 3)
+
+	span := spans[0]
+	assert.Equal(t, "GET /users/:id", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, parent.TraceID(), span.SpanContext().TraceID())
+	assert.Equal(t, parent.SpanID(), span.Parent().SpanID())
+	attrs := span.Attributes()
+	assert.Contains(t, attrs, attribute.String("http.request.method", "GET"))
+	assert.Contains(t, attrs, attribute.String("http.route", "/users/:id"))
+	assert.Contains(t, attrs, attribute.Int("http.response.status_code", 200))
+	assert.Contains(t, attrs, attribute.String("url.path", "/users/1"))
+	assert.Contains(t, attrs, attribute.String("url.query", "a=b"))
+	assert.Contains(t, attrs, attribute.String("server.address", "example.com"))
+	assert.Contains(t, attrs, attribute.Int("server.port", 8080))
+	assert.Contains(t, attrs, attribute.String("user_agent.original", "test-agent"))
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.Contains(t, resp.Header().Get("traceparent"), span.SpanContext().SpanID().String())
+
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+	require.Len(t, spans[2].Events(), 1)
+	assert.Equal(t, "exception", spans[2].Events()[0].Name)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	var found bool
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name != "http.server.request.duration" {
+			continue
+		}
+		found = true
+		hist, ok := m.Data.(metricdata.Histogram[float64])
+		require.True(t, ok)
+		assert.Len(t, hist.DataPoints, 3)
+	}
+	assert.True(t, found)
+}
+
+func TestMiddlewareBuilder_SpanNameFormatter(t *testing.T) {
+	spanRecorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+	builder := MiddlewareBuilder{
+		Tracer: tp.Tracer(instrumentationName),
+		SpanNameFormatter: func(ctx *web_frame.Context) string {
+			return "route:" + ctx.MatchedRoute
+		},
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(builder.Build()))
+	server.Get("/users", func(ctx *web_frame.Context) {})
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	spans := spanRecorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "route:/users", spans[0].Name())
+}
+
 func initZipkin(t *testing.T) {
 	exporter, err := zipkin.New(
 		"http://192.168.64.6:19411/api/v2/spans",
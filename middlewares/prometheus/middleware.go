@@ -1,42 +1,160 @@
 package prometheus
 
 import (
+	"errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
 	"strconv"
 	"time"
 	"web-frame"
 )
 
+const defaultUnmatchedRoute = "unmatched"
+
 type MiddlewareBuilder struct {
 	Namespace string
+	// Name 请求耗时直方图的名字，单位为秒，默认为 http_request_duration_seconds
 	Name      string
 	Subsystem string
 	Help      string
+	// Buckets 请求耗时直方图的桶，默认为 prometheus.DefBuckets
+	Buckets []float64
+	// SizeBuckets 请求和响应大小直方图的桶，单位为字节
+	SizeBuckets []float64
+	// Registerer 默认为 prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
+	// UnmatchedRoute 没有命中路由时使用的 pattern 标签，避免标签基数膨胀
+	UnmatchedRoute string
 }
 
 func (m MiddlewareBuilder) Build() web_frame.Middleware {
-	vector := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+	m = m.withDefaults()
+	labels := []string{"pattern", "method", "status"}
+	duration := register(m.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: m.Namespace,
-		Name:      m.Name,
 		Subsystem: m.Subsystem,
+		Name:      m.Name,
 		Help:      m.Help,
-		Objectives: map[float64]float64{
-			0.5:  0.01,
-			0.75: 0.01,
-			0.90: 0.01,
-			0.99: 0.001,
-		},
-	}, []string{"pattern", "method", "status"})
-	prometheus.MustRegister(vector)
+		Buckets:   m.Buckets,
+	}, labels))
+	reqSize := register(m.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: m.Namespace,
+		Subsystem: m.Subsystem,
+		Name:      "http_request_size_bytes",
+		Help:      "HTTP 请求体大小",
+		Buckets:   m.SizeBuckets,
+	}, labels))
+	respSize := register(m.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: m.Namespace,
+		Subsystem: m.Subsystem,
+		Name:      "http_response_size_bytes",
+		Help:      "HTTP 响应体大小",
+		Buckets:   m.SizeBuckets,
+	}, labels))
+	inFlight := register(m.Registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: m.Namespace,
+		Subsystem: m.Subsystem,
+		Name:      "http_requests_in_flight",
+		Help:      "正在处理的 HTTP 请求数",
+	}))
 	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
 		return func(ctx *web_frame.Context) {
 			startTime := time.Now()
+			inFlight.Inc()
+			writer := &responseWriter{ResponseWriter: ctx.Resp}
+			ctx.Resp = writer
 			defer func() {
-				duration := time.Now().Sub(startTime).Milliseconds()
+				inFlight.Dec()
 				pattern := ctx.MatchedRoute
-				vector.WithLabelValues(pattern, ctx.Req.Method, strconv.Itoa(ctx.RespStatusCode)).Observe(float64(duration))
+				if pattern == "" {
+					pattern = m.UnmatchedRoute
+				}
+				status := ctx.RespStatusCode
+				if status == 0 {
+					status = writer.status
+				}
+				if status == 0 {
+					status = http.StatusOK
+				}
+				lvs := []string{pattern, ctx.Req.Method, strconv.Itoa(status)}
+				duration.WithLabelValues(lvs...).Observe(time.Since(startTime).Seconds())
+				reqSize.WithLabelValues(lvs...).Observe(float64(max(ctx.Req.ContentLength, 0)))
+				respSize.WithLabelValues(lvs...).Observe(float64(writer.size + len(ctx.RespData)))
 			}()
 			next(ctx)
 		}
 	}
 }
+
+// Handler 返回暴露指标的处理函数，可以直接注册为路由，例如 server.Get("/metrics", builder.Handler())
+func (m MiddlewareBuilder) Handler() web_frame.HandleFunc {
+	m = m.withDefaults()
+	gatherer, ok := m.Registerer.(prometheus.Gatherer)
+	if !ok {
+		gatherer = prometheus.DefaultGatherer
+	}
+	h := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	return func(ctx *web_frame.Context) {
+		h.ServeHTTP(ctx.Resp, ctx.Req)
+	}
+}
+
+func (m MiddlewareBuilder) withDefaults() MiddlewareBuilder {
+	if m.Name == "" {
+		m.Name = "http_request_duration_seconds"
+	}
+	if m.Help == "" {
+		m.Help = "HTTP 请求耗时"
+	}
+	if m.Buckets == nil {
+		m.Buckets = prometheus.DefBuckets
+	}
+	if m.SizeBuckets == nil {
+		m.SizeBuckets = prometheus.ExponentialBuckets(128, 4, 8)
+	}
+	if m.Registerer == nil {
+		m.Registerer = prometheus.DefaultRegisterer
+	}
+	if m.UnmatchedRoute == "" {
+		m.UnmatchedRoute = defaultUnmatchedRoute
+	}
+	return m
+}
+
+// register 在指标已经注册过时复用已有的指标，因此可以多次 Build
+func register[T prometheus.Collector](r prometheus.Registerer, c T) T {
+	err := r.Register(c)
+	if err == nil {
+		return c
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
@@ -1,9 +1,15 @@
 package prometheus
 
 import (
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 	"web-frame"
@@ -36,3 +42,71 @@ func TestMiddlewareBuilder_Build(t *testing.T) {
 
 	_ = server.Start(":8081")
 }
+
+func TestMiddlewareBuilder_Registry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	builder := MiddlewareBuilder{
+		Namespace:  "demo",
+		Subsystem:  "web_frame",
+		Registerer: reg,
+	}
+	// 多次 Build 不会 panic，并且共用同一组指标
+	_ = builder.Build()
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(builder.Build()))
+	server.Get("/users/:id", func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte("hello")
+	})
+	server.Get("/metrics", builder.Handler())
+
+	for i := 0; i < 3; i++ {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", strings.NewReader("abc")))
+	}
+
+	count, err := testutil.GatherAndCount(reg, "demo_web_frame_http_request_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, float64(0), testutil.ToFloat64(findGauge(t, reg)))
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	assert.Contains(t, body, `demo_web_frame_http_request_duration_seconds_count{method="GET",pattern="/users/:id",status="200"} 3`)
+	assert.Contains(t, body, `demo_web_frame_http_response_size_bytes_sum{method="GET",pattern="/users/:id",status="200"} 15`)
+	assert.Contains(t, body, `demo_web_frame_http_request_size_bytes_sum{method="GET",pattern="/users/:id",status="200"} 9`)
+}
+
+func TestMiddlewareBuilder_Unmatched(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	builder := MiddlewareBuilder{
+		Registerer: reg,
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(builder.Build()))
+	server.Get("/users/:id", func(ctx *web_frame.Context) {
+		ctx.RespStatusCode = http.StatusOK
+	})
+	server.Get("/metrics", builder.Handler())
+
+	for _, path := range []string{"/nope/x", "/users", "/users/1/orders"} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	}
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/1", nil))
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",pattern="unmatched",status="404"} 3`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="POST",pattern="unmatched",status="404"} 1`)
+}
+
+func findGauge(t *testing.T, reg *prometheus.Registry) prometheus.Collector {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "demo",
+		Subsystem: "web_frame",
+		Name:      "http_requests_in_flight",
+		Help:      "正在处理的 HTTP 请求数",
+	})
+	return register[prometheus.Gauge](reg, gauge)
+}
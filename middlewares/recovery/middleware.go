@@ -1,11 +1,17 @@
 package recovery
 
-import "web-frame"
+import (
+	"log/slog"
+	"runtime/debug"
+	"web-frame"
+)
 
 type MiddlewareBuilder struct {
 	StatueCode int
 	Data       []byte
 	Log        func(ctx *web_frame.Context)
+	// Logger 在 Log 为空时用于输出结构化的 panic 日志，为空则使用 ctx.Logger()
+	Logger *slog.Logger
 }
 
 func (m MiddlewareBuilder) Build() web_frame.Middleware {
@@ -15,7 +21,19 @@ func (m MiddlewareBuilder) Build() web_frame.Middleware {
 				if err := recover(); err != nil {
 					ctx.RespData = m.Data
 					ctx.RespStatusCode = m.StatueCode
-					m.Log(ctx)
+					if m.Log != nil {
+						m.Log(ctx)
+						return
+					}
+					logger := m.Logger
+					if logger == nil {
+						logger = ctx.Logger()
+					}
+					logger.ErrorContext(ctx.Req.Context(), "panic",
+						slog.Any("error", err),
+						slog.String("method", ctx.Req.Method),
+						slog.String("path", ctx.Req.URL.Path),
+						slog.String("stack", string(debug.Stack())))
 				}
 			}()
 			next(ctx)
@@ -1,7 +1,14 @@
 package recovery
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"web-frame"
 )
@@ -23,3 +30,29 @@ func TestMiddlewareBuilder_Build(t *testing.T) {
 
 	_ = server.Start(":8081")
 }
+
+func TestMiddlewareBuilder_Logger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	builder := MiddlewareBuilder{
+		StatueCode: http.StatusInternalServerError,
+		Data:       []byte("panic ..."),
+	}
+	server := web_frame.NewHTTPServer(
+		web_frame.ServerWithLogger(slog.New(slog.NewJSONHandler(buf, nil))),
+		web_frame.ServerWithMiddleware(builder.Build()))
+	server.Get("/users", func(ctx *web_frame.Context) {
+		panic("user panic")
+	})
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "panic ...", recorder.Body.String())
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "user panic", record["error"])
+	assert.Equal(t, "/users", record["route"])
+	assert.NotEmpty(t, record["stack"])
+}
@@ -0,0 +1,53 @@
+package requestid
+
+import (
+	"github.com/google/uuid"
+	"web-frame"
+)
+
+const (
+	DefaultHeader = "X-Request-Id"
+	maxLength     = 128
+)
+
+type MiddlewareBuilder struct {
+	// Header 读取和回写请求 ID 的头部，默认为 X-Request-Id
+	Header string
+	// Generator 生成新的请求 ID，默认为 uuid
+	Generator func() string
+}
+
+func (m MiddlewareBuilder) Build() web_frame.Middleware {
+	if m.Header == "" {
+		m.Header = DefaultHeader
+	}
+	if m.Generator == nil {
+		m.Generator = func() string {
+			return uuid.New().String()
+		}
+	}
+	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
+		return func(ctx *web_frame.Context) {
+			id := ctx.Req.Header.Get(m.Header)
+			if !valid(id) {
+				id = m.Generator()
+			}
+			ctx.RequestID = id
+			ctx.Resp.Header().Set(m.Header, id)
+			next(ctx)
+		}
+	}
+}
+
+// valid 拒绝过长或包含不可见字符的 ID，避免污染日志
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
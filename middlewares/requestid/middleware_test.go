@@ -0,0 +1,67 @@
+package requestid
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"web-frame"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name     string
+		reqID    string
+		wantID   string
+		generate bool
+	}{
+		{
+			name:   "propagate",
+			reqID:  "abc-123",
+			wantID: "abc-123",
+		},
+		{
+			name:     "missing",
+			generate: true,
+		},
+		{
+			name:     "invalid",
+			reqID:    "abc\n123",
+			generate: true,
+		},
+		{
+			name:     "too long",
+			reqID:    strings.Repeat("a", 129),
+			generate: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			builder := MiddlewareBuilder{
+				Generator: func() string {
+					return "generated"
+				},
+			}
+			server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(builder.Build()))
+			var ctxID string
+			server.Get("/users", func(ctx *web_frame.Context) {
+				ctxID = ctx.RequestID
+			})
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tc.reqID != "" {
+				req.Header.Set(DefaultHeader, tc.reqID)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+
+			wantID := tc.wantID
+			if tc.generate {
+				wantID = "generated"
+			}
+			assert.Equal(t, wantID, ctxID)
+			assert.Equal(t, wantID, recorder.Header().Get(DefaultHeader))
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package web_frame
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tusVersion = "1.0.0"
+
+var errorInvalidMetadata = errors.New("web: 无效的 Upload-Metadata")
+
+// ResumableUpload 实现 tus 1.0.0 协议的核心部分以及 creation、termination 扩展，
+// 上传的数据和元数据保存在 Dir 目录中，已经写入的字节数就是数据文件的大小，中断之后可以从这里继续。
+// 需要注册的路由如下，也支持通过 POST 加 X-HTTP-Method-Override 发送 PATCH、DELETE 请求：
+//
+//	h.Options("/files", u.Handle)
+//	h.Post("/files", u.Handle)
+//	h.Head("/files/:id", u.Handle)
+//	h.Patch("/files/:id", u.Handle)
+//	h.Delete("/files/:id", u.Handle)
+//	h.Post("/files/:id", u.Handle)
+type ResumableUpload struct {
+	Dir string
+	// MaxSize 是单个文件的大小限制，0 表示不限制
+	MaxSize int64
+	// OnComplete 在最后一块数据写入之后调用，返回的错误会让本次请求失败，但是数据不会被删除
+	OnComplete func(ctx *Context, info UploadInfo) error
+
+	locks sync.Map
+}
+
+// UploadInfo 是一次可续传上传的状态，以 json 保存在数据文件旁边
+type UploadInfo struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Path 是数据文件的路径
+	Path string `json:"-"`
+	// Checksum 是上传完成后整个文件十六进制编码的 sha256
+	Checksum    string    `json:"checksum,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+func (u *ResumableUpload) Handle(ctx *Context) {
+	header := ctx.Resp.Header()
+	header.Set("Tus-Resumable", tusVersion)
+	method := ctx.Req.Method
+	if override := ctx.Req.Header.Get("X-HTTP-Method-Override"); method == http.MethodPost && override != "" {
+		method = strings.ToUpper(override)
+	}
+	if method == http.MethodOptions {
+		header.Set("Tus-Version", tusVersion)
+		header.Set("Tus-Extension", "creation,termination")
+		if u.MaxSize > 0 {
+			header.Set("Tus-Max-Size", strconv.FormatInt(u.MaxSize, 10))
+		}
+		ctx.RespStatusCode = http.StatusNoContent
+		return
+	}
+	if ctx.Req.Header.Get("Tus-Resumable") != tusVersion {
+		header.Set("Tus-Version", tusVersion)
+		ctx.RespStatusCode = http.StatusPreconditionFailed
+		return
+	}
+
+	id, err := ctx.PathValue("id")
+	if err != nil {
+		if method != http.MethodPost {
+			ctx.RespStatusCode = http.StatusMethodNotAllowed
+			return
+		}
+		u.create(ctx)
+		return
+	}
+	if !validUploadID(id) {
+		ctx.RespStatusCode = http.StatusNotFound
+		return
+	}
+	// 先确认上传存在，不存在的 id 不会在 locks 中留下记录
+	if _, err = u.load(id); err != nil {
+		ctx.RespStatusCode = loadStatus(err)
+		return
+	}
+	// 同一个上传同时只能有一个请求在修改
+	lock, _ := u.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	if !mu.TryLock() {
+		ctx.RespStatusCode = http.StatusLocked
+		return
+	}
+	// 已经完成或者删除的上传不会再被修改，释放对应的锁
+	finished := false
+	defer func() {
+		if finished {
+			u.locks.CompareAndDelete(id, lock)
+		}
+		mu.Unlock()
+	}()
+
+	// 拿到锁之后重新读取，等待期间其他请求可能已经修改了状态
+	info, err := u.load(id)
+	if err != nil {
+		finished = errors.Is(err, fs.ErrNotExist)
+		ctx.RespStatusCode = loadStatus(err)
+		return
+	}
+	switch method {
+	case http.MethodHead:
+		header.Set("Cache-Control", "no-store")
+		header.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+		header.Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+		if len(info.Metadata) > 0 {
+			header.Set("Upload-Metadata", encodeUploadMetadata(info.Metadata))
+		}
+		ctx.RespStatusCode = http.StatusOK
+	case http.MethodPatch:
+		u.patch(ctx, &info)
+	case http.MethodDelete:
+		if err = u.remove(id); err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			return
+		}
+		finished = true
+		ctx.RespStatusCode = http.StatusNoContent
+		return
+	default:
+		ctx.RespStatusCode = http.StatusMethodNotAllowed
+	}
+	finished = info.Offset == info.Length
+}
+
+func loadStatus(err error) int {
+	if errors.Is(err, fs.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (u *ResumableUpload) create(ctx *Context) {
+	length, err := strconv.ParseInt(ctx.Req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		ctx.RespStatusCode = http.StatusBadRequest
+		ctx.RespData = []byte("上传失败: 缺少 Upload-Length")
+		return
+	}
+	if u.MaxSize > 0 && length > u.MaxSize {
+		ctx.RespStatusCode = http.StatusRequestEntityTooLarge
+		return
+	}
+	metadata, err := decodeUploadMetadata(ctx.Req.Header.Get("Upload-Metadata"))
+	if err != nil {
+		ctx.RespStatusCode = http.StatusBadRequest
+		ctx.RespData = []byte("上传失败: 无效的 Upload-Metadata")
+		return
+	}
+	id, err := newUploadID()
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		return
+	}
+	info := UploadInfo{
+		ID:        id,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+	}
+	if err = os.MkdirAll(u.Dir, 0o755); err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		return
+	}
+	f, err := os.OpenFile(u.dataPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		return
+	}
+	_ = f.Close()
+	if err = u.saveInfo(info); err != nil {
+		_ = u.remove(id)
+		ctx.RespStatusCode = http.StatusInternalServerError
+		return
+	}
+	if length == 0 {
+		info.Path = u.dataPath(id)
+		if err = u.complete(ctx, &info); err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			return
+		}
+	}
+	ctx.Resp.Header().Set("Location", strings.TrimSuffix(ctx.Req.URL.Path, "/")+"/"+id)
+	ctx.Resp.Header().Set("Upload-Offset", "0")
+	ctx.RespStatusCode = http.StatusCreated
+}
+
+func (u *ResumableUpload) patch(ctx *Context, info *UploadInfo) {
+	header := ctx.Resp.Header()
+	if ctx.Req.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		ctx.RespStatusCode = http.StatusUnsupportedMediaType
+		return
+	}
+	offset, err := strconv.ParseInt(ctx.Req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		ctx.RespStatusCode = http.StatusBadRequest
+		return
+	}
+	if offset != info.Offset {
+		header.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+		ctx.RespStatusCode = http.StatusConflict
+		return
+	}
+	if info.Offset == info.Length {
+		header.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+		ctx.RespStatusCode = http.StatusNoContent
+		return
+	}
+
+	f, err := os.OpenFile(info.Path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		return
+	}
+	// 即使读取请求体的时候连接断开，已经收到的数据也会保留，客户端可以从新的 offset 继续
+	n, copyErr := io.Copy(f, io.LimitReader(ctx.Req.Body, info.Length-info.Offset))
+	syncErr := f.Sync()
+	closeErr := f.Close()
+	info.Offset += n
+	header.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	if err = errors.Join(syncErr, closeErr); err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		return
+	}
+	if copyErr != nil {
+		ctx.RespStatusCode = http.StatusBadRequest
+		return
+	}
+	if info.Offset == info.Length {
+		if err = u.complete(ctx, info); err != nil {
+			ctx.Logger().Error("web: 完成上传失败", slog.Any("error", err), slog.String("id", info.ID))
+			ctx.RespStatusCode = http.StatusInternalServerError
+			ctx.RespData = []byte(uploadErrorMessage(http.StatusInternalServerError))
+			return
+		}
+	}
+	ctx.RespStatusCode = http.StatusNoContent
+}
+
+// complete 计算整个文件的校验和并保存，然后调用 OnComplete
+func (u *ResumableUpload) complete(ctx *Context, info *UploadInfo) error {
+	f, err := os.Open(info.Path)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	info.Checksum = hex.EncodeToString(h.Sum(nil))
+	info.CompletedAt = time.Now()
+	if err = u.saveInfo(*info); err != nil {
+		return err
+	}
+	if u.OnComplete != nil {
+		return u.OnComplete(ctx, *info)
+	}
+	return nil
+}
+
+// Info 返回上传的状态，可以在 OnComplete 之外查询上传进度
+func (u *ResumableUpload) Info(id string) (UploadInfo, error) {
+	if !validUploadID(id) {
+		return UploadInfo{}, fs.ErrNotExist
+	}
+	return u.load(id)
+}
+
+func (u *ResumableUpload) load(id string) (UploadInfo, error) {
+	var info UploadInfo
+	data, err := os.ReadFile(u.infoPath(id))
+	if err != nil {
+		return info, err
+	}
+	if err = json.Unmarshal(data, &info); err != nil {
+		return info, err
+	}
+	stat, err := os.Stat(u.dataPath(id))
+	if err != nil {
+		return info, err
+	}
+	info.Offset = stat.Size()
+	info.Path = u.dataPath(id)
+	return info, nil
+}
+
+// saveInfo 先写临时文件再重命名，避免进程退出时留下不完整的 json
+func (u *ResumableUpload) saveInfo(info UploadInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tmp := u.infoPath(info.ID) + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.infoPath(info.ID))
+}
+
+func (u *ResumableUpload) remove(id string) error {
+	err := errors.Join(os.Remove(u.dataPath(id)), os.Remove(u.infoPath(id)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (u *ResumableUpload) dataPath(id string) string {
+	return filepath.Join(u.Dir, id+".bin")
+}
+
+func (u *ResumableUpload) infoPath(id string) string {
+	return filepath.Join(u.Dir, id+".info")
+}
+
+func newUploadID() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// validUploadID 只接受 newUploadID 生成的格式，id 会被拼接到文件路径中
+func validUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// decodeUploadMetadata 解析形如 filename d29ybGQ=,is_confidential 的元数据，值为 base64 编码
+func decodeUploadMetadata(header string) (map[string]string, error) {
+	if header == "" {
+		return nil, nil
+	}
+	res := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errorInvalidMetadata
+		}
+		decoded, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return nil, errorInvalidMetadata
+		}
+		res[key] = string(decoded)
+	}
+	return res, nil
+}
+
+func encodeUploadMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, val := range metadata {
+		if val == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(val)))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
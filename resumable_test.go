@@ -0,0 +1,211 @@
+package web_frame
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newResumableServer(u *ResumableUpload) *HTTPServer {
+	h := NewHTTPServer()
+	h.Options("/files", u.Handle)
+	h.Post("/files", u.Handle)
+	h.Head("/files/:id", u.Handle)
+	h.Patch("/files/:id", u.Handle)
+	h.Delete("/files/:id", u.Handle)
+	h.Post("/files/:id", u.Handle)
+	return h
+}
+
+func tusRequest(method string, target string, body io.Reader, header map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestResumableUpload(t *testing.T) {
+	var completed []UploadInfo
+	u := &ResumableUpload{
+		Dir:     t.TempDir(),
+		MaxSize: 100,
+		OnComplete: func(ctx *Context, info UploadInfo) error {
+			completed = append(completed, info)
+			return nil
+		},
+	}
+	h := newResumableServer(u)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		assert.Equal(t, tusVersion, resp.Header().Get("Tus-Resumable"))
+		return resp
+	}
+	patch := func(location string, offset string, data string) *httptest.ResponseRecorder {
+		return serve(tusRequest(http.MethodPatch, location, strings.NewReader(data), map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		}))
+	}
+
+	resp := serve(httptest.NewRequest(http.MethodOptions, "/files", nil))
+	require.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, tusVersion, resp.Header().Get("Tus-Version"))
+	assert.Equal(t, "creation,termination", resp.Header().Get("Tus-Extension"))
+	assert.Equal(t, "100", resp.Header().Get("Tus-Max-Size"))
+
+	// 创建
+	resp = serve(tusRequest(http.MethodPost, "/files", nil, map[string]string{
+		"Upload-Length":   "11",
+		"Upload-Metadata": "filename aGVsbG8udHh0,empty",
+	}))
+	require.Equal(t, http.StatusCreated, resp.Code)
+	location := resp.Header().Get("Location")
+	require.Regexp(t, `^/files/[0-9a-f]{32}$`, location)
+	id := strings.TrimPrefix(location, "/files/")
+
+	resp = serve(tusRequest(http.MethodHead, location, nil, nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "0", resp.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", resp.Header().Get("Upload-Length"))
+	assert.Equal(t, "empty,filename aGVsbG8udHh0", resp.Header().Get("Upload-Metadata"))
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+
+	// 分两次上传，中间有一次 offset 不对
+	resp = patch(location, "0", "hello ")
+	require.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "6", resp.Header().Get("Upload-Offset"))
+
+	resp = patch(location, "0", "hello ")
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Equal(t, "6", resp.Header().Get("Upload-Offset"))
+
+	resp = serve(tusRequest(http.MethodHead, location, nil, nil))
+	assert.Equal(t, "6", resp.Header().Get("Upload-Offset"))
+	assert.Empty(t, completed)
+
+	// 超出长度的数据会被丢弃
+	resp = patch(location, "6", "world!!!")
+	require.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "11", resp.Header().Get("Upload-Offset"))
+
+	require.Len(t, completed, 1)
+	// 完成之后不再保留锁
+	assert.Zero(t, lockCount(u))
+	info := completed[0]
+	assert.Equal(t, id, info.ID)
+	assert.Equal(t, int64(11), info.Offset)
+	assert.Equal(t, map[string]string{"filename": "hello.txt", "empty": ""}, info.Metadata)
+	sum := sha256.Sum256([]byte("hello world"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), info.Checksum)
+	data, err := os.ReadFile(info.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	saved, err := u.Info(id)
+	require.NoError(t, err)
+	assert.Equal(t, info.Checksum, saved.Checksum)
+	assert.False(t, saved.CompletedAt.IsZero())
+
+	// 通过 X-HTTP-Method-Override 删除
+	resp = serve(tusRequest(http.MethodPost, location, nil, map[string]string{"X-HTTP-Method-Override": "DELETE"}))
+	require.Equal(t, http.StatusNoContent, resp.Code)
+	resp = serve(tusRequest(http.MethodHead, location, nil, nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	_, err = os.Stat(info.Path)
+	assert.True(t, os.IsNotExist(err))
+	assert.Zero(t, lockCount(u))
+}
+
+func lockCount(u *ResumableUpload) int {
+	cnt := 0
+	u.locks.Range(func(key, value any) bool {
+		cnt++
+		return true
+	})
+	return cnt
+}
+
+func TestResumableUpload_Errors(t *testing.T) {
+	u := &ResumableUpload{Dir: t.TempDir(), MaxSize: 10}
+	h := newResumableServer(u)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+	resp := serve(tusRequest(http.MethodPost, "/files", nil, map[string]string{"Upload-Length": "5"}))
+	require.Equal(t, http.StatusCreated, resp.Code)
+	location := resp.Header().Get("Location")
+
+	testCases := []struct {
+		name     string
+		req      *http.Request
+		wantCode int
+	}{
+		{
+			name:     "missing version",
+			req:      httptest.NewRequest(http.MethodHead, location, nil),
+			wantCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:     "missing length",
+			req:      tusRequest(http.MethodPost, "/files", nil, nil),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "too large",
+			req:      tusRequest(http.MethodPost, "/files", nil, map[string]string{"Upload-Length": "11"}),
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "invalid metadata",
+			req: tusRequest(http.MethodPost, "/files", nil, map[string]string{
+				"Upload-Length":   "1",
+				"Upload-Metadata": "filename !!!",
+			}),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid id",
+			req:      tusRequest(http.MethodHead, "/files/..", nil, nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "unknown id",
+			req:      tusRequest(http.MethodHead, "/files/"+strings.Repeat("0", 32), nil, nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name: "wrong content type",
+			req: tusRequest(http.MethodPatch, location, strings.NewReader("a"), map[string]string{
+				"Content-Type":  "text/plain",
+				"Upload-Offset": "0",
+			}),
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "missing offset",
+			req: tusRequest(http.MethodPatch, location, strings.NewReader("a"), map[string]string{
+				"Content-Type": "application/offset+octet-stream",
+			}),
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantCode, serve(tc.req).Code)
+		})
+	}
+	// 只有还没完成的上传会持有锁，不存在的 id 不会留下记录
+	assert.Equal(t, 1, lockCount(u))
+}
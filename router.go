@@ -199,6 +199,14 @@ func (rg *routerGroup) Options(path string, handleFunc HandleFunc) {
 	rg.addRoute(http.MethodOptions, path, handleFunc)
 }
 
+func (rg *routerGroup) Head(path string, handleFunc HandleFunc) {
+	rg.addRoute(http.MethodHead, path, handleFunc)
+}
+
+func (rg *routerGroup) Patch(path string, handleFunc HandleFunc) {
+	rg.addRoute(http.MethodPatch, path, handleFunc)
+}
+
 func newRouterGroup() *routerGroup {
 	return &routerGroup{
 		router: newRouter(),
@@ -0,0 +1,216 @@
+package web_frame
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errorInvalidPath = errors.New("web: 无效的文件路径")
+	// errorForbiddenPath 对应 403，errorHiddenPath 对应 404，避免暴露文件是否存在
+	errorForbiddenPath = errors.New("web: 无权访问该文件")
+	errorHiddenPath    = errors.New("web: 文件被隐藏")
+)
+
+// SymlinkPolicy 决定如何处理路径中的符号链接
+type SymlinkPolicy int
+
+const (
+	// SymlinkInside 只允许解析之后仍然位于根目录内部的符号链接，这是默认值
+	SymlinkInside SymlinkPolicy = iota
+	// SymlinkDeny 拒绝路径中任何一级是符号链接的请求
+	SymlinkDeny
+	// SymlinkFollow 跟随所有的符号链接，即使它指向根目录之外
+	SymlinkFollow
+)
+
+// DotfilePolicy 决定如何处理路径中以 . 开头的文件或目录，例如 .git、.env
+type DotfilePolicy int
+
+const (
+	// DotfileIgnore 当作文件不存在，这是默认值
+	DotfileIgnore DotfilePolicy = iota
+	// DotfileDeny 返回 403
+	DotfileDeny
+	// DotfileAllow 和普通文件一样处理
+	DotfileAllow
+)
+
+// PathPolicy 是 FileDownloader 和 StaticResourceHandler 共用的路径访问规则，零值就是默认规则。
+//
+// Allow 和 Deny 是 path.Match 的模式。包含 / 的模式匹配相对于根目录的路径，
+// 不包含 / 的模式匹配路径中的每一级名字。路径本身或者它所在的任意一级目录匹配即算匹配，
+// 例如 Deny 中的 node_modules 会拒绝 node_modules 下的所有文件。
+// Deny 优先于 Allow，Allow 为空时允许所有没有被拒绝的路径
+type PathPolicy struct {
+	Symlinks SymlinkPolicy
+	Dotfiles DotfilePolicy
+	Allow    []string
+	Deny     []string
+}
+
+// cleanPath 把请求中的路径转换为以 / 分隔、不以 / 开头的相对路径，根目录为 .。
+// 包含 ..、反斜杠或者 NUL 的路径直接拒绝，而不是清理之后继续访问
+func cleanPath(name string) (string, error) {
+	if strings.ContainsAny(name, "\\\x00") {
+		return "", errorInvalidPath
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == ".." {
+			return "", errorInvalidPath
+		}
+	}
+	res := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if res == "" {
+		return ".", nil
+	}
+	if !fs.ValidPath(res) {
+		return "", errorInvalidPath
+	}
+	return res, nil
+}
+
+// Check 检查请求的路径是否符合规则，返回清理之后的相对路径，不访问文件系统
+func (p PathPolicy) Check(name string) (string, error) {
+	res, err := cleanPath(name)
+	if err != nil || res == "." {
+		return res, err
+	}
+	segs := strings.Split(res, "/")
+	if p.Dotfiles != DotfileAllow {
+		for _, seg := range segs {
+			if !strings.HasPrefix(seg, ".") {
+				continue
+			}
+			if p.Dotfiles == DotfileDeny {
+				return "", errorForbiddenPath
+			}
+			return "", errorHiddenPath
+		}
+	}
+	if matchAny(p.Deny, segs) {
+		return "", errorForbiddenPath
+	}
+	if len(p.Allow) > 0 && !matchAny(p.Allow, segs) {
+		return "", errorForbiddenPath
+	}
+	return res, nil
+}
+
+// Join 检查路径之后把它拼接到 root 上，并按照 Symlinks 检查符号链接。
+// 目标文件不存在时不会返回错误，由调用者在打开文件时处理
+func (p PathPolicy) Join(root string, name string) (string, error) {
+	rel, err := p.Check(name)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(root, filepath.FromSlash(rel))
+	if !within(root, dst) {
+		return "", errorInvalidPath
+	}
+	switch p.Symlinks {
+	case SymlinkFollow:
+		return dst, nil
+	case SymlinkDeny:
+		return dst, denySymlinks(root, rel)
+	default:
+		return dst, symlinksInside(root, dst)
+	}
+}
+
+// denySymlinks 逐级检查 root 下的路径，root 本身可以是符号链接
+func denySymlinks(root string, rel string) error {
+	if rel == "." {
+		return nil
+	}
+	cur := root
+	for _, seg := range strings.Split(rel, "/") {
+		cur = filepath.Join(cur, seg)
+		info, err := os.Lstat(cur)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return errorForbiddenPath
+		}
+	}
+	return nil
+}
+
+// symlinksInside 解析所有的符号链接之后，确认目标仍然在 root 的真实路径之内
+func symlinksInside(root string, dst string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realDst, err := filepath.EvalSymlinks(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !within(realRoot, realDst) {
+		return errorForbiddenPath
+	}
+	return nil
+}
+
+// within 判断 dst 是否为 root 或者位于 root 之内，按照路径分段比较，/srv/data-evil 不在 /srv/data 之内
+func within(root string, dst string) bool {
+	rel, err := filepath.Rel(root, dst)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel))
+}
+
+func matchAny(patterns []string, segs []string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			for i := range segs {
+				if ok, _ := path.Match(pattern, strings.Join(segs[:i+1], "/")); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for _, seg := range segs {
+			if ok, _ := path.Match(pattern, seg); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPathError 判断错误是否由 PathPolicy 拒绝访问导致
+func isPathError(err error) bool {
+	return errors.Is(err, errorHiddenPath) || errors.Is(err, errorForbiddenPath) || errors.Is(err, errorInvalidPath)
+}
+
+func respPathError(ctx *Context, err error) {
+	switch {
+	case errors.Is(err, errorHiddenPath):
+		ctx.RespStatusCode = http.StatusNotFound
+		ctx.RespData = []byte("文件不存在")
+	case errors.Is(err, errorForbiddenPath), errors.Is(err, errorInvalidPath):
+		ctx.RespStatusCode = http.StatusForbidden
+		ctx.RespData = []byte("无权访问")
+	default:
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("服务器内部错误")
+	}
+}
@@ -0,0 +1,155 @@
+package web_frame
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newPolicyTree 创建下面的目录结构，返回 base 的路径
+//
+//	base/public.txt
+//	base/.env
+//	base/.git/config
+//	base/node_modules/x.js
+//	base/assets/app.js
+//	base/link-inside -> assets/app.js
+//	base/link-outside -> ../secret.txt
+//	base/linkdir -> ../outside
+//	base-evil/x.txt
+//	secret.txt
+//	outside/y.txt
+func newPolicyTree(t *testing.T) string {
+	root := t.TempDir()
+	files := []string{
+		"base/public.txt",
+		"base/.env",
+		"base/.git/config",
+		"base/node_modules/x.js",
+		"base/assets/app.js",
+		"base-evil/x.txt",
+		"secret.txt",
+		"outside/y.txt",
+	}
+	for _, f := range files {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(f), 0o644))
+	}
+	base := filepath.Join(root, "base")
+	require.NoError(t, os.Symlink(filepath.Join("assets", "app.js"), filepath.Join(base, "link-inside")))
+	require.NoError(t, os.Symlink(filepath.Join("..", "secret.txt"), filepath.Join(base, "link-outside")))
+	require.NoError(t, os.Symlink(filepath.Join("..", "outside"), filepath.Join(base, "linkdir")))
+	return base
+}
+
+func TestPathPolicy_Join(t *testing.T) {
+	base := newPolicyTree(t)
+	testCases := []struct {
+		name    string
+		policy  PathPolicy
+		file    string
+		want    string
+		wantErr error
+	}{
+		{name: "file", file: "public.txt", want: "public.txt"},
+		{name: "root", file: "", want: "."},
+		{name: "leading slash", file: "/public.txt", want: "public.txt"},
+		{name: "absolute", file: "/etc/passwd", want: "etc/passwd"},
+		{name: "duplicate slashes", file: "assets//app.js", want: "assets/app.js"},
+		{name: "missing file", file: "missing.txt", want: "missing.txt"},
+
+		// 目录穿越
+		{name: "parent", file: "../secret.txt", wantErr: errorInvalidPath},
+		{name: "prefix sibling", file: "../base-evil/x.txt", wantErr: errorInvalidPath},
+		{name: "nested parent", file: "assets/../../secret.txt", wantErr: errorInvalidPath},
+		{name: "parent inside", file: "assets/../public.txt", wantErr: errorInvalidPath},
+		{name: "trailing parent", file: "assets/..", wantErr: errorInvalidPath},
+		{name: "backslash", file: `..\secret.txt`, wantErr: errorInvalidPath},
+		{name: "nul", file: "public.txt\x00.js", wantErr: errorInvalidPath},
+
+		// 隐藏文件
+		{name: "dotfile", file: ".env", wantErr: errorHiddenPath},
+		{name: "dot dir", file: ".git/config", wantErr: errorHiddenPath},
+		{name: "dotfile deny", policy: PathPolicy{Dotfiles: DotfileDeny}, file: ".env", wantErr: errorForbiddenPath},
+		{name: "dotfile allow", policy: PathPolicy{Dotfiles: DotfileAllow}, file: ".git/config", want: ".git/config"},
+
+		// 符号链接
+		{name: "symlink inside", file: "link-inside", want: "link-inside"},
+		{name: "symlink outside", file: "link-outside", wantErr: errorForbiddenPath},
+		{name: "symlink dir outside", file: "linkdir/y.txt", wantErr: errorForbiddenPath},
+		{name: "symlink deny", policy: PathPolicy{Symlinks: SymlinkDeny}, file: "link-inside", wantErr: errorForbiddenPath},
+		{name: "symlink deny dir", policy: PathPolicy{Symlinks: SymlinkDeny}, file: "linkdir/y.txt", wantErr: errorForbiddenPath},
+		{name: "symlink deny plain", policy: PathPolicy{Symlinks: SymlinkDeny}, file: "assets/app.js", want: "assets/app.js"},
+		{name: "symlink follow", policy: PathPolicy{Symlinks: SymlinkFollow}, file: "linkdir/y.txt", want: "linkdir/y.txt"},
+
+		// 允许和拒绝
+		{name: "deny name", policy: PathPolicy{Deny: []string{"node_modules"}}, file: "node_modules/x.js", wantErr: errorForbiddenPath},
+		{name: "deny glob", policy: PathPolicy{Deny: []string{"*.txt"}}, file: "public.txt", wantErr: errorForbiddenPath},
+		{name: "deny path", policy: PathPolicy{Deny: []string{"assets/*.js"}}, file: "assets/app.js", wantErr: errorForbiddenPath},
+		{name: "allow dir", policy: PathPolicy{Allow: []string{"assets"}}, file: "assets/app.js", want: "assets/app.js"},
+		{name: "not allowed", policy: PathPolicy{Allow: []string{"assets"}}, file: "public.txt", wantErr: errorForbiddenPath},
+		{
+			name:    "deny before allow",
+			policy:  PathPolicy{Allow: []string{"*.js"}, Deny: []string{"node_modules"}},
+			file:    "node_modules/x.js",
+			wantErr: errorForbiddenPath,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst, err := tc.policy.Join(base, tc.file)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, filepath.Join(base, filepath.FromSlash(tc.want)), dst)
+		})
+	}
+}
+
+func TestPathPolicy_JoinRelativeRoot(t *testing.T) {
+	base := newPolicyTree(t)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(filepath.Dir(base)))
+	defer func() {
+		require.NoError(t, os.Chdir(wd))
+	}()
+
+	dst, err := PathPolicy{}.Join("base", "public.txt")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(base, "public.txt"), dst)
+	_, err = PathPolicy{}.Join("base", "../base-evil/x.txt")
+	assert.Equal(t, errorInvalidPath, err)
+	_, err = PathPolicy{}.Join("./base/", "link-outside")
+	assert.Equal(t, errorForbiddenPath, err)
+}
+
+func TestPathPolicy_SymlinkRoot(t *testing.T) {
+	base := newPolicyTree(t)
+	// 根目录本身是符号链接时，指向真实目录内部的链接仍然可以访问
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t, os.Symlink(base, root))
+	for _, policy := range []PathPolicy{{}, {Symlinks: SymlinkDeny}} {
+		dst, err := policy.Join(root, "public.txt")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(root, "public.txt"), dst)
+	}
+	_, err := PathPolicy{}.Join(root, "link-inside")
+	assert.NoError(t, err)
+	_, err = PathPolicy{}.Join(root, "link-outside")
+	assert.Equal(t, errorForbiddenPath, err)
+}
+
+func TestWithin(t *testing.T) {
+	root := filepath.FromSlash("/srv/data")
+	assert.True(t, within(root, root))
+	assert.True(t, within(root, filepath.FromSlash("/srv/data/a")))
+	assert.True(t, within(root, filepath.FromSlash("/srv/data/..a")))
+	assert.False(t, within(root, filepath.FromSlash("/srv/data-evil")))
+	assert.False(t, within(root, filepath.FromSlash("/srv/data-evil/a")))
+	assert.False(t, within(root, filepath.FromSlash("/srv")))
+}
@@ -1,7 +1,7 @@
 package web_frame
 
 import (
-	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 )
@@ -23,7 +23,7 @@ type HTTPServerOption func(server *HTTPServer)
 type HTTPServer struct {
 	*routerGroup
 
-	log func(msg string, args ...any)
+	log *slog.Logger
 
 	tplEngine TemplateEngine
 }
@@ -33,6 +33,7 @@ func (h *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request
 		Req:       request,
 		Resp:      writer,
 		tplEngine: h.tplEngine,
+		logger:    h.log,
 	}
 
 	h.serve(ctx)
@@ -44,7 +45,7 @@ func (h *HTTPServer) flashResp(ctx *Context) {
 	}
 	_, err := ctx.Resp.Write(ctx.RespData)
 	if err != nil {
-		h.log("响应写入失败: ", err)
+		ctx.Logger().Error("web: 响应写入失败", slog.Any("error", err))
 	}
 }
 
@@ -61,13 +62,15 @@ func (h *HTTPServer) serve(ctx *Context) {
 		info.n.handler(ctx)
 	}
 
-	if ok && info.n != nil {
+	// 没有命中路由时也执行 server 级别的 middleware，这样 404 也会被记录到日志和指标中
+	mdls := h.mdls
+	if ok && info.n.handler != nil {
 		ctx.PathParams = info.pathParams
 		ctx.MatchedRoute = info.n.route
-
-		for i := len(info.n.mdls) - 1; i >= 0; i-- {
-			root = info.n.mdls[i](root)
-		}
+		mdls = info.n.mdls
+	}
+	for i := len(mdls) - 1; i >= 0; i-- {
+		root = mdls[i](root)
 	}
 
 	var m Middleware = func(next HandleFunc) HandleFunc {
@@ -92,9 +95,7 @@ func (h *HTTPServer) Start(addr string) error {
 func NewHTTPServer(opts ...HTTPServerOption) *HTTPServer {
 	res := &HTTPServer{
 		routerGroup: newRouterGroup(),
-		log: func(msg string, args ...any) {
-			fmt.Printf(msg, args...)
-		},
+		log:         slog.Default(),
 	}
 
 	for _, opt := range opts {
@@ -110,6 +111,12 @@ func ServerWithTemplateEngine(tplEngine TemplateEngine) HTTPServerOption {
 	}
 }
 
+func ServerWithLogger(logger *slog.Logger) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.log = logger
+	}
+}
+
 func ServerWithMiddleware(mdls ...Middleware) HTTPServerOption {
 	return func(server *HTTPServer) {
 		server.mdls = mdls
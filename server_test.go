@@ -1,8 +1,14 @@
 package web_frame
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -34,3 +40,24 @@ func TestHttpServer(t *testing.T) {
 
 	_ = h.Start(":8081")
 }
+
+func TestContext_Logger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := NewHTTPServer(ServerWithLogger(slog.New(slog.NewJSONHandler(buf, nil))),
+		ServerWithMiddleware(func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				ctx.RequestID = "req-1"
+				next(ctx)
+			}
+		}))
+	h.Get("/order/:id", func(ctx *Context) {
+		ctx.Logger().Info("hello")
+	})
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/order/1", nil))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "hello", record["msg"])
+	assert.Equal(t, "/order/:id", record["route"])
+	assert.Equal(t, "req-1", record["request_id"])
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"reflect"
+)
+
+var ErrTypeMismatch = errors.New("session: 值的类型不匹配")
+
+// Codec 用于把 session 的值序列化后保存，例如保存到 redis
+type Codec interface {
+	Marshal(val any) ([]byte, error)
+	Unmarshal(data []byte, val any) error
+}
+
+// ValueDecoder 由以序列化形式保存值的 Session 实现，能够把值直接解码为目标类型
+type ValueDecoder interface {
+	GetInto(ctx context.Context, key string, dst any) error
+}
+
+// GetAs 以指定的类型读取 session 的值
+func GetAs[T any](ctx context.Context, sess Session, key string) (T, error) {
+	var res T
+	if d, ok := sess.(ValueDecoder); ok {
+		err := d.GetInto(ctx, key, &res)
+		return res, err
+	}
+	val, err := sess.Get(ctx, key)
+	if err != nil {
+		return res, err
+	}
+	res, ok := val.(T)
+	if !ok {
+		return res, fmt.Errorf("%w: %s 的类型为 %T", ErrTypeMismatch, key, val)
+	}
+	return res, nil
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(val any) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (JSONCodec) Unmarshal(data []byte, val any) error {
+	return json.Unmarshal(data, val)
+}
+
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Marshal(val any) ([]byte, error) {
+	return msgpack.Marshal(val)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, val any) error {
+	return msgpack.Unmarshal(data, val)
+}
+
+// GobCodec 会保留值的具体类型，解码到 any 时与 memory 的行为一致。自定义类型需要先调用 gob.Register
+type GobCodec struct{}
+
+type gobValue struct {
+	V any
+}
+
+func (GobCodec) Marshal(val any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(&gobValue{V: val})
+	return buf.Bytes(), err
+}
+
+func (GobCodec) Unmarshal(data []byte, val any) error {
+	gv := &gobValue{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(gv); err != nil {
+		return err
+	}
+	dst := reflect.ValueOf(val)
+	if dst.Kind() != reflect.Pointer || dst.IsNil() {
+		return errors.New("session: 解码目标必须是非空指针")
+	}
+	elem := dst.Elem()
+	if gv.V == nil {
+		elem.Set(reflect.Zero(elem.Type()))
+		return nil
+	}
+	src := reflect.ValueOf(gv.V)
+	if !src.Type().AssignableTo(elem.Type()) {
+		return fmt.Errorf("%w: 无法把 %s 赋值给 %s", ErrTypeMismatch, src.Type(), elem.Type())
+	}
+	elem.Set(src)
+	return nil
+}
@@ -0,0 +1,115 @@
+package cookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	errNoKeys          = errors.New("cookie: 至少需要一个签名或加密密钥")
+	errInvalidValue    = errors.New("cookie: 值格式错误")
+	errInvalidHMAC     = errors.New("cookie: 签名校验失败")
+	errDecryptFailed   = errors.New("cookie: 解密失败")
+	errInvalidBlockKey = errors.New("cookie: 加密密钥长度必须是 16、24 或 32 字节")
+)
+
+// Codec 对 cookie 的值做 HMAC-SHA256 签名和可选的 AES-GCM 加密。
+// 编码总是使用第一个密钥，解码时依次尝试所有密钥，轮换时把新密钥放在最前面即可
+type Codec struct {
+	hashKeys [][]byte
+	aeads    []cipher.AEAD
+}
+
+func NewCodec(hashKeys [][]byte, blockKeys [][]byte) (*Codec, error) {
+	if len(hashKeys) == 0 && len(blockKeys) == 0 {
+		return nil, errNoKeys
+	}
+	c := &Codec{
+		hashKeys: hashKeys,
+	}
+	for _, key := range blockKeys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errInvalidBlockKey
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads = append(c.aeads, aead)
+	}
+	return c, nil
+}
+
+// Encode 的结果绑定了 cookie 的名字，防止把一个 cookie 的值挪到另一个 cookie 使用
+func (c *Codec) Encode(name string, value []byte) (string, error) {
+	data := value
+	if len(c.aeads) > 0 {
+		aead := c.aeads[0]
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		data = aead.Seal(nonce, nonce, value, []byte(name))
+	}
+	res := base64.RawURLEncoding.EncodeToString(data)
+	if len(c.hashKeys) > 0 {
+		res = res + "." + base64.RawURLEncoding.EncodeToString(sign(c.hashKeys[0], name, res))
+	}
+	return res, nil
+}
+
+func (c *Codec) Decode(name string, value string) ([]byte, error) {
+	if len(c.hashKeys) > 0 {
+		payload, sig, ok := strings.Cut(value, ".")
+		if !ok {
+			return nil, errInvalidValue
+		}
+		mac, err := base64.RawURLEncoding.DecodeString(sig)
+		if err != nil {
+			return nil, errInvalidValue
+		}
+		verified := false
+		for _, key := range c.hashKeys {
+			if hmac.Equal(sign(key, name, payload), mac) {
+				verified = true
+				break
+			}
+		}
+		if !verified {
+			return nil, errInvalidHMAC
+		}
+		value = payload
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidValue
+	}
+	if len(c.aeads) == 0 {
+		return data, nil
+	}
+	for _, aead := range c.aeads {
+		if len(data) < aead.NonceSize() {
+			return nil, errInvalidValue
+		}
+		nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+		plain, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+		if err == nil {
+			return plain, nil
+		}
+	}
+	return nil, errDecryptFailed
+}
+
+func sign(key []byte, name string, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = fmt.Fprintf(mac, "%s|%s", name, payload)
+	return mac.Sum(nil)
+}
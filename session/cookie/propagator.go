@@ -2,38 +2,166 @@ package cookie
 
 import (
 	"net/http"
+	"time"
 )
 
+const (
+	// PrefixHost 要求 Secure、Path=/ 并且不能设置 Domain
+	PrefixHost = "__Host-"
+	// PrefixSecure 要求 Secure
+	PrefixSecure = "__Secure-"
+)
+
+type PropagatorOption func(propagator *Propagator)
+
 type Propagator struct {
 	CookieName string
+	// MaxAge 为 0 时写入会话 cookie
+	MaxAge   time.Duration
+	Path     string
+	Domain   string
+	Secure   bool
+	HTTPOnly bool
+	SameSite http.SameSite
+	Prefix   string
+	codec    *Codec
 }
 
-func NewPropagator() *Propagator {
-	return &Propagator{
+func NewPropagator(opts ...PropagatorOption) *Propagator {
+	res := &Propagator{
 		CookieName: "sessid",
+		Path:       "/",
+		HTTPOnly:   true,
+		SameSite:   http.SameSiteLaxMode,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func PropagatorWithMaxAge(maxAge time.Duration) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.MaxAge = maxAge
+	}
+}
+
+func PropagatorWithCookieName(name string) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.CookieName = name
+	}
+}
+
+func PropagatorWithPath(path string) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.Path = path
+	}
+}
+
+func PropagatorWithDomain(domain string) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.Domain = domain
+	}
+}
+
+func PropagatorWithSecure(secure bool) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.Secure = secure
+	}
+}
+
+func PropagatorWithHTTPOnly(httpOnly bool) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.HTTPOnly = httpOnly
+	}
+}
+
+func PropagatorWithSameSite(sameSite http.SameSite) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.SameSite = sameSite
+	}
+}
+
+// PropagatorWithPrefix 设置 PrefixHost 或 PrefixSecure，并自动满足前缀对属性的要求
+func PropagatorWithPrefix(prefix string) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.Prefix = prefix
+	}
+}
+
+// PropagatorWithCodec 对 session id 做签名，或者同时加密
+func PropagatorWithCodec(codec *Codec) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.codec = codec
 	}
 }
 
 func (p *Propagator) Inject(id string, writer http.ResponseWriter) error {
-	http.SetCookie(writer, &http.Cookie{
-		Name:  p.CookieName,
-		Value: id,
-	})
+	return p.InjectWithMaxAge(id, p.MaxAge, writer)
+}
+
+func (p *Propagator) InjectWithMaxAge(id string, maxAge time.Duration, writer http.ResponseWriter) error {
+	val := id
+	if p.codec != nil {
+		var err error
+		val, err = p.codec.Encode(p.name(), []byte(id))
+		if err != nil {
+			return err
+		}
+	}
+	c := p.newCookie(val)
+	if maxAge > 0 {
+		c.MaxAge = int(maxAge.Seconds())
+		c.Expires = time.Now().Add(maxAge)
+	}
+	http.SetCookie(writer, c)
 	return nil
 }
 
 func (p *Propagator) Extract(req *http.Request) (string, error) {
-	c, err := req.Cookie(p.CookieName)
+	c, err := req.Cookie(p.name())
+	if err != nil {
+		return "", err
+	}
+	if p.codec == nil {
+		return c.Value, nil
+	}
+	id, err := p.codec.Decode(p.name(), c.Value)
 	if err != nil {
 		return "", err
 	}
-	return c.Value, nil
+	return string(id), nil
 }
 
 func (p *Propagator) Remove(writer http.ResponseWriter) error {
-	http.SetCookie(writer, &http.Cookie{
-		Name:   p.CookieName,
-		MaxAge: -1,
-	})
+	c := p.newCookie("")
+	c.MaxAge = -1
+	c.Expires = time.Unix(0, 0)
+	http.SetCookie(writer, c)
 	return nil
 }
+
+func (p *Propagator) name() string {
+	return p.Prefix + p.CookieName
+}
+
+func (p *Propagator) newCookie(val string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     p.name(),
+		Value:    val,
+		Path:     p.Path,
+		Domain:   p.Domain,
+		Secure:   p.Secure,
+		HttpOnly: p.HTTPOnly,
+		SameSite: p.SameSite,
+	}
+	switch p.Prefix {
+	case PrefixHost:
+		c.Secure = true
+		c.Path = "/"
+		c.Domain = ""
+	case PrefixSecure:
+		c.Secure = true
+	}
+	return c
+}
@@ -0,0 +1,162 @@
+package cookie
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPropagator_Inject(t *testing.T) {
+	testCases := []struct {
+		name   string
+		opts   []PropagatorOption
+		wantSC string
+	}{
+		{
+			name:   "default",
+			wantSC: "sessid=abc; Path=/; HttpOnly; SameSite=Lax",
+		},
+		{
+			name: "all options",
+			opts: []PropagatorOption{
+				PropagatorWithCookieName("sid"),
+				PropagatorWithPath("/app"),
+				PropagatorWithDomain("example.com"),
+				PropagatorWithSecure(true),
+				PropagatorWithHTTPOnly(false),
+				PropagatorWithSameSite(http.SameSiteStrictMode),
+			},
+			wantSC: "sid=abc; Path=/app; Domain=example.com; Secure; SameSite=Strict",
+		},
+		{
+			name: "host prefix",
+			opts: []PropagatorOption{
+				PropagatorWithPrefix(PrefixHost),
+				PropagatorWithPath("/app"),
+				PropagatorWithDomain("example.com"),
+			},
+			wantSC: "__Host-sessid=abc; Path=/; HttpOnly; Secure; SameSite=Lax",
+		},
+		{
+			name: "secure prefix",
+			opts: []PropagatorOption{
+				PropagatorWithPrefix(PrefixSecure),
+			},
+			wantSC: "__Secure-sessid=abc; Path=/; HttpOnly; Secure; SameSite=Lax",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewPropagator(tc.opts...)
+			recorder := httptest.NewRecorder()
+			require.NoError(t, p.Inject("abc", recorder))
+			assert.Equal(t, tc.wantSC, recorder.Header().Get("Set-Cookie"))
+		})
+	}
+}
+
+func TestPropagator_MaxAgeAndRemove(t *testing.T) {
+	p := NewPropagator(PropagatorWithMaxAge(time.Minute), PropagatorWithPath("/app"))
+	recorder := httptest.NewRecorder()
+	require.NoError(t, p.Inject("abc", recorder))
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, 60, cookies[0].MaxAge)
+
+	recorder = httptest.NewRecorder()
+	require.NoError(t, p.Remove(recorder))
+	cookies = recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, -1, cookies[0].MaxAge)
+	assert.Equal(t, "/app", cookies[0].Path)
+}
+
+func TestPropagator_Codec(t *testing.T) {
+	oldCodec, err := NewCodec([][]byte{[]byte("old-hash")}, [][]byte{[]byte("0123456789abcdef")})
+	require.NoError(t, err)
+	rotated, err := NewCodec([][]byte{[]byte("new-hash"), []byte("old-hash")},
+		[][]byte{[]byte("fedcba9876543210"), []byte("0123456789abcdef")})
+	require.NoError(t, err)
+	signOnly, err := NewCodec([][]byte{[]byte("new-hash")}, nil)
+	require.NoError(t, err)
+
+	oldP := NewPropagator(PropagatorWithCodec(oldCodec))
+	recorder := httptest.NewRecorder()
+	require.NoError(t, oldP.Inject("session-id", recorder))
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.NotContains(t, cookies[0].Value, "session-id")
+
+	testCases := []struct {
+		name    string
+		p       *Propagator
+		value   string
+		wantID  string
+		wantErr bool
+	}{
+		{
+			name:   "rotated keys",
+			p:      NewPropagator(PropagatorWithCodec(rotated)),
+			value:  cookies[0].Value,
+			wantID: "session-id",
+		},
+		{
+			name:    "unknown key",
+			p:       NewPropagator(PropagatorWithCodec(signOnly)),
+			value:   cookies[0].Value,
+			wantErr: true,
+		},
+		{
+			name:    "tampered",
+			p:       NewPropagator(PropagatorWithCodec(rotated)),
+			value:   "x" + cookies[0].Value,
+			wantErr: true,
+		},
+		{
+			name:    "unsigned",
+			p:       NewPropagator(PropagatorWithCodec(rotated)),
+			value:   "session-id",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: "sessid", Value: tc.value})
+			id, err := tc.p.Extract(req)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantID, id)
+		})
+	}
+}
+
+func TestCodec_BindName(t *testing.T) {
+	c, err := NewCodec([][]byte{[]byte("hash")}, nil)
+	require.NoError(t, err)
+	val, err := c.Encode("a", []byte("hello"))
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(val, "."))
+
+	data, err := c.Decode("a", val)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	_, err = c.Decode("b", val)
+	assert.Error(t, err)
+}
+
+func TestNewCodec_InvalidKey(t *testing.T) {
+	_, err := NewCodec(nil, nil)
+	assert.Error(t, err)
+	_, err = NewCodec(nil, [][]byte{[]byte("short")})
+	assert.Error(t, err)
+}
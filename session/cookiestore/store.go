@@ -0,0 +1,402 @@
+package cookiestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+	"web-frame"
+	"web-frame/session"
+	"web-frame/session/cookie"
+)
+
+var (
+	errorKeyNotFound        = session.ErrKeyNotFound
+	errorKeySessionNotFound = errors.New("session: session 找不到")
+	errorNoMiddleware       = errors.New("cookiestore: 没有使用 Store.Middleware")
+	ErrCookieTooLarge       = errors.New("cookiestore: session 编码后超过 cookie 的大小限制")
+)
+
+type StoreOption func(store *Store)
+
+// Store 把 session 的全部数据签名、加密后保存在 cookie 里，服务端不保存任何状态。
+// 需要在 session.Manager 之前使用 Middleware，Manager 的 Propagator 使用 Store.Propagator。
+// 数据在响应写出之前写回 cookie，所以直接写 ctx.Resp 的 handler 也能正确保存。
+// 密钥轮换由 cookie.Codec 负责，旧的 cookie 在被修改或续期时会用新密钥重新编码。
+// 因为没有服务端状态，Remove 和 Regenerate 只能让当前客户端的 cookie 失效，无法作废已经泄露的旧 cookie
+type Store struct {
+	codec      *cookie.Codec
+	valueCodec session.Codec
+	cookie     *cookie.Propagator
+	expiration time.Duration
+	maxSize    int
+	now        func() time.Time
+}
+
+func NewStore(codec *cookie.Codec, opts ...StoreOption) *Store {
+	res := &Store{
+		codec:      codec,
+		valueCodec: session.GobCodec{},
+		cookie:     cookie.NewPropagator(cookie.PropagatorWithCookieName("session")),
+		expiration: time.Minute * 15,
+		maxSize:    4096,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func StoreWithExpiration(expiration time.Duration) StoreOption {
+	return func(store *Store) {
+		store.expiration = expiration
+	}
+}
+
+// StoreWithCodec 设置值的序列化方式，默认为 session.GobCodec
+func StoreWithCodec(codec session.Codec) StoreOption {
+	return func(store *Store) {
+		store.valueCodec = codec
+	}
+}
+
+// StoreWithMaxSize 设置 cookie 值编码后的最大字节数，默认 4096
+func StoreWithMaxSize(size int) StoreOption {
+	return func(store *Store) {
+		store.maxSize = size
+	}
+}
+
+// StoreWithCookieOptions 设置 cookie 的名字和属性，默认名字为 session
+func StoreWithCookieOptions(opts ...cookie.PropagatorOption) StoreOption {
+	return func(store *Store) {
+		store.cookie = cookie.NewPropagator(append([]cookie.PropagatorOption{
+			cookie.PropagatorWithCookieName("session")}, opts...)...)
+	}
+}
+
+func (s *Store) Expiration() time.Duration {
+	return s.expiration
+}
+
+// Propagator 返回与 Store 配套的 session.Propagator，cookie 由 Store 在响应时统一写出
+func (s *Store) Propagator() session.Propagator {
+	return propagator{}
+}
+
+// Middleware 解码请求中的 cookie，并在响应写出之前把修改过的 session 写回 cookie
+func (s *Store) Middleware() web_frame.Middleware {
+	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
+		return func(ctx *web_frame.Context) {
+			st := &state{}
+			if val, err := s.cookie.Extract(ctx.Req); err == nil {
+				st.sess, err = s.decode(val)
+				// 无效或者过期的 cookie 在响应时删除
+				st.stale = err != nil
+			}
+			ctx.Req = ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), stateKey{}, st))
+			ctx.Resp = &responseWriter{
+				ResponseWriter: ctx.Resp,
+				save: func(writer http.ResponseWriter) {
+					if err := s.save(writer, st); err != nil {
+						ctx.Logger().Error("cookiestore: 写回 session 失败", "error", err)
+					}
+				},
+			}
+			next(ctx)
+		}
+	}
+}
+
+func (s *Store) Generate(ctx context.Context, id string) (session.Session, error) {
+	st, err := stateFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.sess = &Session{
+		store:  s,
+		id:     id,
+		values: make(map[string][]byte),
+		dirty:  true,
+	}
+	st.removed = false
+	return st.sess, nil
+}
+
+func (s *Store) Refresh(ctx context.Context, id string) error {
+	sess, err := s.find(ctx, id)
+	if err != nil {
+		return err
+	}
+	sess.mutex.Lock()
+	sess.dirty = true
+	sess.mutex.Unlock()
+	return nil
+}
+
+func (s *Store) Remove(ctx context.Context, id string) error {
+	st, err := stateFrom(ctx)
+	if err != nil {
+		return err
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.sess != nil && st.sess.id == id {
+		st.sess = nil
+		st.removed = true
+	}
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (session.Session, error) {
+	return s.find(ctx, id)
+}
+
+// Regenerate 更换 session id，旧 id 的 cookie 会在响应时被覆盖
+func (s *Store) Regenerate(ctx context.Context, oldID string, newID string) (session.Session, error) {
+	sess, err := s.find(ctx, oldID)
+	if err != nil {
+		return nil, err
+	}
+	sess.mutex.Lock()
+	sess.id = newID
+	sess.dirty = true
+	sess.mutex.Unlock()
+	return sess, nil
+}
+
+func (s *Store) find(ctx context.Context, id string) (*Session, error) {
+	st, err := stateFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.sess == nil || st.sess.id != id {
+		return nil, errorKeySessionNotFound
+	}
+	return st.sess, nil
+}
+
+func (s *Store) save(writer http.ResponseWriter, st *state) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.sess == nil {
+		if st.removed || st.stale {
+			return s.cookie.Remove(writer)
+		}
+		return nil
+	}
+	st.sess.mutex.Lock()
+	defer st.sess.mutex.Unlock()
+	if !st.sess.dirty {
+		return nil
+	}
+	val, err := s.encode(st.sess)
+	if err != nil {
+		return err
+	}
+	return s.cookie.InjectWithMaxAge(val, s.expiration, writer)
+}
+
+type payload struct {
+	ID        string
+	ExpiresAt int64
+	Values    map[string][]byte
+}
+
+// encode 调用方需要持有 sess 的锁
+func (s *Store) encode(sess *Session) (string, error) {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(payload{
+		ID:        sess.id,
+		ExpiresAt: s.now().Add(s.expiration).Unix(),
+		Values:    sess.values,
+	})
+	if err != nil {
+		return "", err
+	}
+	val, err := s.codec.Encode(s.cookie.Prefix+s.cookie.CookieName, buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+	if len(val) > s.maxSize {
+		return "", ErrCookieTooLarge
+	}
+	return val, nil
+}
+
+func (s *Store) decode(val string) (*Session, error) {
+	data, err := s.codec.Decode(s.cookie.Prefix+s.cookie.CookieName, val)
+	if err != nil {
+		return nil, err
+	}
+	var p payload
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&p); err != nil {
+		return nil, err
+	}
+	if s.now().Unix() >= p.ExpiresAt {
+		return nil, errorKeySessionNotFound
+	}
+	if p.Values == nil {
+		p.Values = make(map[string][]byte)
+	}
+	return &Session{
+		store:  s,
+		id:     p.ID,
+		values: p.Values,
+	}, nil
+}
+
+type Session struct {
+	mutex  sync.Mutex
+	store  *Store
+	id     string
+	values map[string][]byte
+	dirty  bool
+}
+
+func (s *Session) Get(ctx context.Context, key string) (any, error) {
+	var val any
+	err := s.GetInto(ctx, key, &val)
+	return val, err
+}
+
+func (s *Session) GetInto(ctx context.Context, key string, dst any) error {
+	s.mutex.Lock()
+	data, ok := s.values[key]
+	s.mutex.Unlock()
+	if !ok {
+		return errorKeyNotFound
+	}
+	return s.store.valueCodec.Unmarshal(data, dst)
+}
+
+// Set 在 session 编码后超过大小限制时返回 ErrCookieTooLarge，并且不修改 session
+func (s *Session) Set(ctx context.Context, key string, val any) error {
+	data, err := s.store.valueCodec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	old, existed := s.values[key]
+	s.values[key] = data
+	if _, err = s.store.encode(s); err != nil {
+		if existed {
+			s.values[key] = old
+		} else {
+			delete(s.values, key)
+		}
+		return err
+	}
+	s.dirty = true
+	return nil
+}
+
+func (s *Session) Delete(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.values, key)
+	s.dirty = true
+	return nil
+}
+
+func (s *Session) Keys(ctx context.Context) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		if !session.IsReservedKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *Session) Clear(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key := range s.values {
+		if !session.IsReservedKey(key) {
+			delete(s.values, key)
+		}
+	}
+	s.dirty = true
+	return nil
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+type stateKey struct{}
+
+// state 保存一次请求内的 session
+type state struct {
+	mutex   sync.Mutex
+	sess    *Session
+	removed bool
+	stale   bool
+}
+
+func stateFrom(ctx context.Context) (*state, error) {
+	st, ok := ctx.Value(stateKey{}).(*state)
+	if !ok {
+		return nil, errorNoMiddleware
+	}
+	return st, nil
+}
+
+// propagator 从 Middleware 解码的 cookie 中取 session id，写入和删除都交给 Store 在响应时完成
+type propagator struct{}
+
+func (propagator) Inject(id string, writer http.ResponseWriter) error {
+	return nil
+}
+
+func (propagator) Extract(req *http.Request) (string, error) {
+	st, err := stateFrom(req.Context())
+	if err != nil {
+		return "", err
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.sess == nil {
+		return "", http.ErrNoCookie
+	}
+	return st.sess.id, nil
+}
+
+func (propagator) Remove(writer http.ResponseWriter) error {
+	return nil
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	save  func(writer http.ResponseWriter)
+	saved bool
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	w.flush()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.flush()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseWriter) flush() {
+	if !w.saved {
+		w.saved = true
+		w.save(w.ResponseWriter)
+	}
+}
@@ -0,0 +1,156 @@
+package cookiestore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"web-frame"
+	"web-frame/session"
+	"web-frame/session/cookie"
+)
+
+func newCodec(t *testing.T, hashKey string) *cookie.Codec {
+	codec, err := cookie.NewCodec([][]byte{[]byte(hashKey)}, [][]byte{[]byte("0123456789abcdef")})
+	require.NoError(t, err)
+	return codec
+}
+
+func newServer(store *Store) *web_frame.HTTPServer {
+	m := &session.Manager{
+		Propagator: store.Propagator(),
+		Store:      store,
+		CtxSessKey: "sessKey",
+	}
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(store.Middleware(), m.Middleware()))
+	server.Post("/login", func(ctx *web_frame.Context) {
+		sess, err := m.InitSession(ctx)
+		if err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			return
+		}
+		_ = sess.Set(ctx.Req.Context(), "nickname", "bill")
+	})
+	server.Get("/user", func(ctx *web_frame.Context) {
+		sess, err := m.GetSession(ctx)
+		if err != nil {
+			ctx.RespStatusCode = http.StatusUnauthorized
+			return
+		}
+		nickname, _ := session.GetAs[string](ctx.Req.Context(), sess, "nickname")
+		ctx.RespData = []byte(nickname)
+	})
+	server.Post("/big", func(ctx *web_frame.Context) {
+		sess, err := m.GetSession(ctx)
+		if err != nil {
+			ctx.RespStatusCode = http.StatusUnauthorized
+			return
+		}
+		if err = sess.Set(ctx.Req.Context(), "big", strings.Repeat("a", 5000)); err != nil {
+			ctx.RespData = []byte(err.Error())
+		}
+	})
+	server.Post("/logout", func(ctx *web_frame.Context) {
+		_ = m.RemoveSession(ctx)
+	})
+	return server
+}
+
+func serve(server *web_frame.HTTPServer, method string, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestStore(t *testing.T) {
+	server := newServer(NewStore(newCodec(t, "hash-key")))
+
+	resp := serve(server, http.MethodPost, "/login")
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, 900, cookies[0].MaxAge)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.NotContains(t, cookies[0].Value, "bill")
+
+	resp = serve(server, http.MethodGet, "/user", cookies[0])
+	assert.Equal(t, "bill", resp.Body.String())
+	// 访问过的 session 会被续期并写回
+	require.Len(t, resp.Result().Cookies(), 1)
+
+	resp = serve(server, http.MethodPost, "/big", cookies[0])
+	assert.Equal(t, ErrCookieTooLarge.Error(), resp.Body.String())
+
+	resp = serve(server, http.MethodPost, "/logout", cookies[0])
+	removed := resp.Result().Cookies()
+	require.Len(t, removed, 1)
+	assert.Equal(t, -1, removed[0].MaxAge)
+
+	resp = serve(server, http.MethodGet, "/user")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestStore_Tampered(t *testing.T) {
+	server := newServer(NewStore(newCodec(t, "hash-key")))
+	cookies := serve(server, http.MethodPost, "/login").Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	tampered := *cookies[0]
+	first := "x"
+	if tampered.Value[:1] == first {
+		first = "y"
+	}
+	tampered.Value = first + tampered.Value[1:]
+	resp := serve(server, http.MethodGet, "/user", &tampered)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	// 无效的 cookie 会被删除
+	removed := resp.Result().Cookies()
+	require.Len(t, removed, 1)
+	assert.Equal(t, -1, removed[0].MaxAge)
+}
+
+func TestStore_Expired(t *testing.T) {
+	store := NewStore(newCodec(t, "hash-key"), StoreWithExpiration(time.Minute))
+	server := newServer(store)
+	cookies := serve(server, http.MethodPost, "/login").Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	store.now = func() time.Time {
+		return time.Now().Add(time.Minute * 2)
+	}
+	resp := serve(server, http.MethodGet, "/user", cookies[0])
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestStore_KeyRotation(t *testing.T) {
+	oldServer := newServer(NewStore(newCodec(t, "old-key")))
+	cookies := serve(oldServer, http.MethodPost, "/login").Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	codec, err := cookie.NewCodec([][]byte{[]byte("new-key"), []byte("old-key")},
+		[][]byte{[]byte("0123456789abcdef")})
+	require.NoError(t, err)
+	rotatingServer := newServer(NewStore(codec))
+	resp := serve(rotatingServer, http.MethodGet, "/user", cookies[0])
+	assert.Equal(t, "bill", resp.Body.String())
+	rotated := resp.Result().Cookies()
+	require.Len(t, rotated, 1)
+
+	// 重新编码之后只用新密钥也能解码
+	onlyNew := newServer(NewStore(newCodec(t, "new-key")))
+	resp = serve(onlyNew, http.MethodGet, "/user", rotated[0])
+	assert.Equal(t, "bill", resp.Body.String())
+}
+
+func TestStore_WithoutMiddleware(t *testing.T) {
+	store := NewStore(newCodec(t, "hash-key"))
+	_, err := store.Generate(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "id")
+	assert.Equal(t, errorNoMiddleware, err)
+}
@@ -0,0 +1,344 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"web-frame/session"
+)
+
+var (
+	errorKeyNotFound        = session.ErrKeyNotFound
+	errorKeySessionNotFound = errors.New("session: session 找不到")
+	errorSessionExists      = errors.New("session: 新 id 对应的 session 已存在")
+)
+
+const fileExt = ".sess"
+
+type StoreOption func(store *Store)
+
+// Store 把每个 session 保存为目录下的一个文件，文件的修改时间就是最后一次续期的时间。
+// 写入先写临时文件再重命名，保证文件不会只写了一半。锁只在进程内有效，多个进程不能共用一个目录
+type Store struct {
+	mutex      sync.Mutex
+	dir        string
+	expiration time.Duration
+	gcInterval time.Duration
+	codec      session.Codec
+	now        func() time.Time
+	stop       chan struct{}
+	closeOnce  sync.Once
+}
+
+func NewStore(dir string, opts ...StoreOption) (*Store, error) {
+	res := &Store{
+		dir:        dir,
+		expiration: time.Minute * 15,
+		gcInterval: time.Minute,
+		codec:      session.GobCodec{},
+		now:        time.Now,
+		stop:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if res.gcInterval > 0 {
+		go res.gcLoop()
+	}
+	return res, nil
+}
+
+func StoreWithExpiration(expiration time.Duration) StoreOption {
+	return func(store *Store) {
+		store.expiration = expiration
+	}
+}
+
+// StoreWithCodec 设置值的序列化方式，默认为 session.GobCodec
+func StoreWithCodec(codec session.Codec) StoreOption {
+	return func(store *Store) {
+		store.codec = codec
+	}
+}
+
+// StoreWithGCInterval 设置后台清理过期文件的间隔，默认一分钟，0 表示不在后台清理
+func StoreWithGCInterval(interval time.Duration) StoreOption {
+	return func(store *Store) {
+		store.gcInterval = interval
+	}
+}
+
+func (s *Store) Expiration() time.Duration {
+	return s.expiration
+}
+
+// Close 停止后台清理
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
+
+func (s *Store) Generate(ctx context.Context, id string) (session.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.write(id, &record{ID: id, Values: map[string][]byte{}}, s.now())
+	if err != nil {
+		return nil, err
+	}
+	return &Session{id: id, store: s}, nil
+}
+
+func (s *Store) Refresh(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, _, err := s.load(id); err != nil {
+		return err
+	}
+	now := s.now()
+	return os.Chtimes(s.path(id), now, now)
+}
+
+func (s *Store) Remove(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := os.Remove(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) Get(ctx context.Context, id string) (session.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, _, err := s.load(id); err != nil {
+		return nil, err
+	}
+	return &Session{id: id, store: s}, nil
+}
+
+func (s *Store) Regenerate(ctx context.Context, oldID string, newID string) (session.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	rec, _, err := s.load(oldID)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err = s.load(newID); err == nil {
+		return nil, errorSessionExists
+	}
+	rec.ID = newID
+	if err = s.write(newID, rec, s.now()); err != nil {
+		return nil, err
+	}
+	if err = os.Remove(s.path(oldID)); err != nil {
+		return nil, err
+	}
+	return &Session{id: newID, store: s}, nil
+}
+
+// GC 删除所有过期的 session 文件
+func (s *Store) GC() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if s.expired(info.ModTime()) {
+			_ = os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+	return nil
+}
+
+func (s *Store) gcLoop() {
+	ticker := time.NewTicker(s.gcInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.GC()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// path 使用 id 的哈希作为文件名，避免 id 中的特殊字符访问到目录之外的文件
+func (s *Store) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+fileExt)
+}
+
+func (s *Store) expired(modTime time.Time) bool {
+	return !s.now().Before(modTime.Add(s.expiration))
+}
+
+type record struct {
+	ID     string
+	Values map[string][]byte
+}
+
+// load 读取 session 文件，同时返回最后一次续期的时间。调用方需要持有锁
+func (s *Store) load(id string) (*record, time.Time, error) {
+	path := s.path(id)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, errorKeySessionNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if s.expired(info.ModTime()) {
+		_ = os.Remove(path)
+		return nil, time.Time{}, errorKeySessionNotFound
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	rec := &record{}
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(rec); err != nil {
+		return nil, time.Time{}, err
+	}
+	if rec.Values == nil {
+		rec.Values = map[string][]byte{}
+	}
+	return rec, info.ModTime(), nil
+}
+
+// write 原子地写入 session 文件，并把修改时间设置为 refreshedAt。调用方需要持有锁
+func (s *Store) write(id string, rec *record, refreshedAt time.Time) error {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(rec); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp.Name(), refreshedAt, refreshedAt); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(id))
+}
+
+// update 读取 session 后修改并写回，写回不会延长有效期
+func (s *Store) update(id string, fn func(rec *record)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	rec, refreshedAt, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	fn(rec)
+	return s.write(id, rec, refreshedAt)
+}
+
+type Session struct {
+	store *Store
+	id    string
+}
+
+func (s *Session) Get(ctx context.Context, key string) (any, error) {
+	var val any
+	err := s.GetInto(ctx, key, &val)
+	return val, err
+}
+
+func (s *Session) GetInto(ctx context.Context, key string, dst any) error {
+	s.store.mutex.Lock()
+	rec, _, err := s.store.load(s.id)
+	s.store.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	data, ok := rec.Values[key]
+	if !ok {
+		return errorKeyNotFound
+	}
+	return s.store.codec.Unmarshal(data, dst)
+}
+
+func (s *Session) Set(ctx context.Context, key string, val any) error {
+	data, err := s.store.codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return s.store.update(s.id, func(rec *record) {
+		rec.Values[key] = data
+	})
+}
+
+func (s *Session) Delete(ctx context.Context, key string) error {
+	return s.store.update(s.id, func(rec *record) {
+		delete(rec.Values, key)
+	})
+}
+
+func (s *Session) Keys(ctx context.Context) ([]string, error) {
+	s.store.mutex.Lock()
+	rec, _, err := s.store.load(s.id)
+	s.store.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(rec.Values))
+	for key := range rec.Values {
+		if !session.IsReservedKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *Session) Clear(ctx context.Context) error {
+	return s.store.update(s.id, func(rec *record) {
+		for key := range rec.Values {
+			if !session.IsReservedKey(key) {
+				delete(rec.Values, key)
+			}
+		}
+	})
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
@@ -0,0 +1,67 @@
+package file
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore_GC(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, StoreWithExpiration(time.Minute), StoreWithGCInterval(0))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = store.Generate(ctx, "old")
+	require.NoError(t, err)
+	store.now = func() time.Time {
+		return time.Now().Add(time.Second * 50)
+	}
+	_, err = store.Generate(ctx, "new")
+	require.NoError(t, err)
+
+	store.now = func() time.Time {
+		return time.Now().Add(time.Second * 70)
+	}
+	require.NoError(t, store.GC())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	_, err = store.Get(ctx, "old")
+	assert.Equal(t, errorKeySessionNotFound, err)
+	_, err = store.Get(ctx, "new")
+	assert.NoError(t, err)
+}
+
+func TestStore_SetKeepsExpiration(t *testing.T) {
+	store, err := NewStore(t.TempDir(), StoreWithExpiration(time.Minute), StoreWithGCInterval(0))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	sess, err := store.Generate(ctx, "sess-1")
+	require.NoError(t, err)
+	store.now = func() time.Time {
+		return time.Now().Add(time.Second * 50)
+	}
+	require.NoError(t, sess.Set(ctx, "name", "bill"))
+
+	store.now = func() time.Time {
+		return time.Now().Add(time.Second * 70)
+	}
+	_, err = store.Get(ctx, "sess-1")
+	assert.Equal(t, errorKeySessionNotFound, err)
+}
+
+func TestStore_PathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, StoreWithGCInterval(0))
+	require.NoError(t, err)
+	_, err = store.Generate(context.Background(), "../../etc/passwd")
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
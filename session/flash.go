@@ -0,0 +1,41 @@
+package session
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+)
+
+const flashKey = ReservedKeyPrefix + "flash"
+
+// FlashMessage 是只显示一次的消息，通常在重定向之前设置，在下一个请求里读取
+type FlashMessage struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+func init() {
+	gob.Register([]FlashMessage{})
+}
+
+// AddFlash 追加一条消息，直到被 Flashes 读取之前都会保存在 session 里
+func AddFlash(ctx context.Context, sess Session, kind string, msg string) error {
+	flashes, err := GetAs[[]FlashMessage](ctx, sess, flashKey)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	flashes = append(flashes, FlashMessage{Kind: kind, Message: msg})
+	return sess.Set(ctx, flashKey, flashes)
+}
+
+// Flashes 读取并删除所有的消息
+func Flashes(ctx context.Context, sess Session) ([]FlashMessage, error) {
+	flashes, err := GetAs[[]FlashMessage](ctx, sess, flashKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return flashes, sess.Delete(ctx, flashKey)
+}
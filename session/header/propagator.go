@@ -0,0 +1,68 @@
+package header
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+var errSessionIDNotFound = errors.New("session: 请求头中没有 session id")
+
+type PropagatorOption func(propagator *Propagator)
+
+type Propagator struct {
+	HeaderName string
+	// Bearer 为 true 时值的格式为 "Bearer <id>"
+	Bearer bool
+}
+
+func NewPropagator(opts ...PropagatorOption) *Propagator {
+	res := &Propagator{
+		HeaderName: "X-Session-Id",
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func PropagatorWithHeaderName(name string) PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.HeaderName = name
+	}
+}
+
+func PropagatorWithBearer() PropagatorOption {
+	return func(propagator *Propagator) {
+		propagator.Bearer = true
+	}
+}
+
+func (p *Propagator) Inject(id string, writer http.ResponseWriter) error {
+	if p.Bearer {
+		id = bearerPrefix + id
+	}
+	writer.Header().Set(p.HeaderName, id)
+	return nil
+}
+
+func (p *Propagator) Extract(req *http.Request) (string, error) {
+	val := strings.TrimSpace(req.Header.Get(p.HeaderName))
+	if p.Bearer {
+		if len(val) < len(bearerPrefix) || !strings.EqualFold(val[:len(bearerPrefix)], bearerPrefix) {
+			return "", errSessionIDNotFound
+		}
+		val = strings.TrimSpace(val[len(bearerPrefix):])
+	}
+	if val == "" {
+		return "", errSessionIDNotFound
+	}
+	return val, nil
+}
+
+func (p *Propagator) Remove(writer http.ResponseWriter) error {
+	writer.Header().Del(p.HeaderName)
+	return nil
+}
@@ -0,0 +1,72 @@
+package header
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPropagator(t *testing.T) {
+	testCases := []struct {
+		name      string
+		p         *Propagator
+		reqHeader string
+		reqValue  string
+		wantID    string
+		wantErr   bool
+		wantResp  string
+	}{
+		{
+			name:      "default header",
+			p:         NewPropagator(),
+			reqHeader: "X-Session-Id",
+			reqValue:  "abc",
+			wantID:    "abc",
+			wantResp:  "abc",
+		},
+		{
+			name:      "bearer",
+			p:         NewPropagator(PropagatorWithHeaderName("Authorization"), PropagatorWithBearer()),
+			reqHeader: "Authorization",
+			reqValue:  "bearer abc",
+			wantID:    "abc",
+			wantResp:  "Bearer abc",
+		},
+		{
+			name:      "bearer missing prefix",
+			p:         NewPropagator(PropagatorWithHeaderName("Authorization"), PropagatorWithBearer()),
+			reqHeader: "Authorization",
+			reqValue:  "abc",
+			wantErr:   true,
+		},
+		{
+			name:    "missing",
+			p:       NewPropagator(),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.reqHeader != "" {
+				req.Header.Set(tc.reqHeader, tc.reqValue)
+			}
+			id, err := tc.p.Extract(req)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantID, id)
+
+			recorder := httptest.NewRecorder()
+			require.NoError(t, tc.p.Inject(id, recorder))
+			assert.Equal(t, tc.wantResp, recorder.Header().Get(tc.p.HeaderName))
+			require.NoError(t, tc.p.Remove(recorder))
+			assert.Empty(t, recorder.Header().Get(tc.p.HeaderName))
+		})
+	}
+}
@@ -1,14 +1,30 @@
 package session
 
 import (
+	"errors"
 	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"time"
 	"web-frame"
 )
 
+const userIDKey = ReservedKeyPrefix + "user_id"
+
+var (
+	ErrSessionExpired         = errors.New("session: session 已超过最长有效期")
+	ErrRegenerateNotSupported = errors.New("session: Store 不支持重新生成 id")
+	ErrUserIndexNotSupported  = errors.New("session: Store 不支持按用户索引 session")
+)
+
 type Manager struct {
 	Propagator
 	Store
 	CtxSessKey string
+	// MaxLifetime session 从创建开始的最长有效期，不受续期影响，0 表示不限制
+	MaxLifetime time.Duration
+	// ClientIP 返回记录到 SessionInfo 的客户端 IP，默认使用 RemoteAddr
+	ClientIP func(req *http.Request) string
 }
 
 func (m *Manager) GetSession(ctx *web_frame.Context) (Session, error) {
@@ -27,6 +43,17 @@ func (m *Manager) GetSession(ctx *web_frame.Context) (Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	if m.MaxLifetime > 0 {
+		createdAt, err := m.createdAt(ctx, sess)
+		if err != nil {
+			return nil, err
+		}
+		if time.Since(createdAt) >= m.MaxLifetime {
+			_ = m.Store.Remove(ctx.Req.Context(), sess.ID())
+			_ = m.Propagator.Remove(ctx.Resp)
+			return nil, ErrSessionExpired
+		}
+	}
 	ctx.UserValues[m.CtxSessKey] = sess
 	return sess, err
 }
@@ -37,7 +64,16 @@ func (m *Manager) InitSession(ctx *web_frame.Context) (Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = m.Inject(id, ctx.Resp)
+	err = sess.Set(ctx.Req.Context(), CreatedAtKey, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 2)
+	}
+	ctx.UserValues[m.CtxSessKey] = sess
+	ctx.UserValues[m.refreshedKey()] = true
+	err = m.inject(ctx, sess, time.Now())
 	return sess, err
 }
 
@@ -46,7 +82,51 @@ func (m *Manager) RefreshSession(ctx *web_frame.Context) error {
 	if err != nil {
 		return err
 	}
-	return m.Refresh(ctx.Req.Context(), sess.ID())
+	err = m.Refresh(ctx.Req.Context(), sess.ID())
+	if err != nil {
+		return err
+	}
+	ctx.UserValues[m.refreshedKey()] = true
+	if err = m.touch(ctx, sess); err != nil {
+		return err
+	}
+	createdAt := time.Now()
+	if m.MaxLifetime > 0 {
+		createdAt, err = m.createdAt(ctx, sess)
+		if err != nil {
+			return err
+		}
+	}
+	return m.inject(ctx, sess, createdAt)
+}
+
+// RegenerateSession 为当前 session 更换 id 并保留数据，用于登录等权限变化之后防止会话固定攻击
+func (m *Manager) RegenerateSession(ctx *web_frame.Context) (Session, error) {
+	r, ok := m.Store.(Regenerator)
+	if !ok {
+		return nil, ErrRegenerateNotSupported
+	}
+	sess, err := m.GetSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newSess, err := r.Regenerate(ctx.Req.Context(), sess.ID(), uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+	ctx.UserValues[m.CtxSessKey] = newSess
+	ctx.UserValues[m.refreshedKey()] = true
+	if err = m.touch(ctx, newSess); err != nil {
+		return nil, err
+	}
+	createdAt := time.Now()
+	if m.MaxLifetime > 0 {
+		createdAt, err = m.createdAt(ctx, newSess)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newSess, m.inject(ctx, newSess, createdAt)
 }
 
 func (m *Manager) RemoveSession(ctx *web_frame.Context) error {
@@ -59,5 +139,161 @@ func (m *Manager) RemoveSession(ctx *web_frame.Context) error {
 	if err != nil {
 		return err
 	}
+	delete(ctx.UserValues, m.CtxSessKey)
+	return m.Propagator.Remove(ctx.Resp)
+}
+
+// BindUser 把当前 session 关联到用户，之后可以按用户列出和注销 session
+func (m *Manager) BindUser(ctx *web_frame.Context, userID string) error {
+	idx, ok := m.Store.(UserIndex)
+	if !ok {
+		return ErrUserIndexNotSupported
+	}
+	sess, err := m.GetSession(ctx)
+	if err != nil {
+		return err
+	}
+	if err = sess.Set(ctx.Req.Context(), userIDKey, userID); err != nil {
+		return err
+	}
+	return m.index(ctx, idx, sess, userID)
+}
+
+// ListUserSessions 返回用户所有仍然有效的 session
+func (m *Manager) ListUserSessions(ctx *web_frame.Context, userID string) ([]SessionInfo, error) {
+	idx, ok := m.Store.(UserIndex)
+	if !ok {
+		return nil, ErrUserIndexNotSupported
+	}
+	return idx.List(ctx.Req.Context(), userID)
+}
+
+// RevokeUserSession 注销用户的某个 session，例如在其它设备上退出登录
+func (m *Manager) RevokeUserSession(ctx *web_frame.Context, userID string, id string) error {
+	idx, ok := m.Store.(UserIndex)
+	if !ok {
+		return ErrUserIndexNotSupported
+	}
+	if err := idx.Revoke(ctx.Req.Context(), userID, id); err != nil {
+		return err
+	}
+	if sess, err := m.GetSession(ctx); err == nil && sess.ID() == id {
+		return m.forget(ctx)
+	}
+	return nil
+}
+
+// RevokeUserSessions 注销用户的所有 session，包括当前请求的 session
+func (m *Manager) RevokeUserSessions(ctx *web_frame.Context, userID string) error {
+	idx, ok := m.Store.(UserIndex)
+	if !ok {
+		return ErrUserIndexNotSupported
+	}
+	current := ""
+	if sess, err := m.GetSession(ctx); err == nil {
+		current, _ = GetAs[string](ctx.Req.Context(), sess, userIDKey)
+	}
+	if err := idx.RevokeAll(ctx.Req.Context(), userID); err != nil {
+		return err
+	}
+	if current == userID {
+		return m.forget(ctx)
+	}
+	return nil
+}
+
+// forget 删除 Context 中缓存的 session 和客户端保存的 id
+func (m *Manager) forget(ctx *web_frame.Context) error {
+	delete(ctx.UserValues, m.CtxSessKey)
 	return m.Propagator.Remove(ctx.Resp)
 }
+
+// touch 更新已经关联用户的 session 的元数据
+func (m *Manager) touch(ctx *web_frame.Context, sess Session) error {
+	idx, ok := m.Store.(UserIndex)
+	if !ok {
+		return nil
+	}
+	userID, err := GetAs[string](ctx.Req.Context(), sess, userIDKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return m.index(ctx, idx, sess, userID)
+}
+
+func (m *Manager) index(ctx *web_frame.Context, idx UserIndex, sess Session, userID string) error {
+	createdAt, err := m.createdAt(ctx, sess)
+	if err != nil {
+		return err
+	}
+	return idx.Index(ctx.Req.Context(), SessionInfo{
+		ID:        sess.ID(),
+		UserID:    userID,
+		CreatedAt: createdAt,
+		LastSeen:  time.Now(),
+		UserAgent: ctx.Req.UserAgent(),
+		IP:        m.clientIP(ctx.Req),
+	})
+}
+
+func (m *Manager) clientIP(req *http.Request) string {
+	if m.ClientIP != nil {
+		return m.ClientIP(req)
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// Middleware 在请求处理完成后为访问过的 session 续期。session 在第一次调用 GetSession 时才会加载
+func (m *Manager) Middleware() web_frame.Middleware {
+	return func(next web_frame.HandleFunc) web_frame.HandleFunc {
+		return func(ctx *web_frame.Context) {
+			next(ctx)
+			if _, ok := ctx.UserValues[m.CtxSessKey]; !ok {
+				return
+			}
+			if refreshed, _ := ctx.UserValues[m.refreshedKey()].(bool); refreshed {
+				return
+			}
+			if err := m.RefreshSession(ctx); err != nil {
+				ctx.Logger().Warn("session: 续期失败", "error", err)
+			}
+		}
+	}
+}
+
+// inject 写入 session id，有效期取 Store 的有效期和剩余最长有效期中较小的一个
+func (m *Manager) inject(ctx *web_frame.Context, sess Session, createdAt time.Time) error {
+	var maxAge time.Duration
+	if es, ok := m.Store.(ExpirationStore); ok {
+		maxAge = es.Expiration()
+	}
+	if m.MaxLifetime > 0 {
+		remaining := time.Until(createdAt.Add(m.MaxLifetime))
+		if maxAge == 0 || remaining < maxAge {
+			maxAge = remaining
+		}
+	}
+	if p, ok := m.Propagator.(MaxAgePropagator); ok && maxAge > 0 {
+		return p.InjectWithMaxAge(sess.ID(), maxAge, ctx.Resp)
+	}
+	return m.Inject(sess.ID(), ctx.Resp)
+}
+
+func (m *Manager) createdAt(ctx *web_frame.Context, sess Session) (time.Time, error) {
+	sec, err := GetAs[int64](ctx.Req.Context(), sess, CreatedAtKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
+
+func (m *Manager) refreshedKey() string {
+	return m.CtxSessKey + "_refreshed"
+}
@@ -4,28 +4,38 @@ import (
 	"context"
 	"errors"
 	"github.com/patrickmn/go-cache"
+	"sort"
 	"sync"
 	"time"
 	"web-frame/session"
 )
 
 var (
-	errorKeyNotFound        = errors.New("session: key 找不到")
+	errorKeyNotFound        = session.ErrKeyNotFound
 	errorKeySessionNotFound = errors.New("session: session 找不到")
+	errorSessionExists      = errors.New("session: 新 id 对应的 session 已存在")
 )
 
 type Store struct {
+	mutex      sync.Mutex
 	sessions   *cache.Cache
 	expiration time.Duration
+	// users 保存用户到 session 元数据的索引，已经过期的 session 在 List 时清理
+	users map[string]map[string]session.SessionInfo
 }
 
 func NewStore(expiration time.Duration) *Store {
 	return &Store{
 		sessions:   cache.New(expiration, time.Second),
 		expiration: expiration,
+		users:      map[string]map[string]session.SessionInfo{},
 	}
 }
 
+func (s *Store) Expiration() time.Duration {
+	return s.expiration
+}
+
 func (s *Store) Generate(ctx context.Context, id string) (session.Session, error) {
 	sess := &Session{
 		values: sync.Map{},
@@ -36,6 +46,8 @@ func (s *Store) Generate(ctx context.Context, id string) (session.Session, error
 }
 
 func (s *Store) Refresh(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	val, ok := s.sessions.Get(id)
 	if !ok {
 		return errors.New("session: 该 id 对应 session 不存在")
@@ -49,6 +61,90 @@ func (s *Store) Remove(ctx context.Context, id string) error {
 	return nil
 }
 
+func (s *Store) Regenerate(ctx context.Context, oldID string, newID string) (session.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	val, ok := s.sessions.Get(oldID)
+	if !ok {
+		return nil, errorKeySessionNotFound
+	}
+	if _, ok = s.sessions.Get(newID); ok {
+		return nil, errorSessionExists
+	}
+	old := val.(*Session)
+	sess := &Session{
+		id: newID,
+	}
+	old.values.Range(func(key, value any) bool {
+		sess.values.Store(key, value)
+		return true
+	})
+	s.sessions.Set(newID, sess, s.expiration)
+	s.sessions.Delete(oldID)
+	return sess, nil
+}
+
+func (s *Store) Index(ctx context.Context, info session.SessionInfo) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.sessions.Get(info.ID); !ok {
+		return errorKeySessionNotFound
+	}
+	infos, ok := s.users[info.UserID]
+	if !ok {
+		infos = map[string]session.SessionInfo{}
+		s.users[info.UserID] = infos
+	}
+	infos[info.ID] = info
+	return nil
+}
+
+func (s *Store) List(ctx context.Context, userID string) ([]session.SessionInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	infos := s.users[userID]
+	res := make([]session.SessionInfo, 0, len(infos))
+	for id, info := range infos {
+		if _, ok := s.sessions.Get(id); !ok {
+			delete(infos, id)
+			continue
+		}
+		res = append(res, info)
+	}
+	if len(infos) == 0 {
+		delete(s.users, userID)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+func (s *Store) Revoke(ctx context.Context, userID string, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	infos := s.users[userID]
+	if _, ok := infos[id]; !ok {
+		return nil
+	}
+	delete(infos, id)
+	s.sessions.Delete(id)
+	return nil
+}
+
+func (s *Store) RevokeAll(ctx context.Context, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id := range s.users[userID] {
+		s.sessions.Delete(id)
+	}
+	delete(s.users, userID)
+	return nil
+}
+
 func (s *Store) Get(ctx context.Context, id string) (session.Session, error) {
 	sess, ok := s.sessions.Get(id)
 	if !ok {
@@ -75,6 +171,32 @@ func (s *Session) Set(ctx context.Context, key string, val any) error {
 	return nil
 }
 
+func (s *Session) Delete(ctx context.Context, key string) error {
+	s.values.Delete(key)
+	return nil
+}
+
+func (s *Session) Keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	s.values.Range(func(key, value any) bool {
+		if k := key.(string); !session.IsReservedKey(k) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return keys, nil
+}
+
+func (s *Session) Clear(ctx context.Context) error {
+	s.values.Range(func(key, value any) bool {
+		if !session.IsReservedKey(key.(string)) {
+			s.values.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
 func (s *Session) ID() string {
 	return s.id
 }
@@ -0,0 +1,66 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var errNoPropagator = errors.New("session: 没有可用的 Propagator")
+
+// CompositePropagator 按顺序尝试多个 Propagator 提取 session id，写入和删除时作用于全部 Propagator，
+// 例如同时支持浏览器的 cookie 和 API 客户端的请求头
+type CompositePropagator struct {
+	propagators []Propagator
+}
+
+func NewCompositePropagator(propagators ...Propagator) *CompositePropagator {
+	return &CompositePropagator{
+		propagators: propagators,
+	}
+}
+
+func (c *CompositePropagator) Inject(id string, writer http.ResponseWriter) error {
+	for _, p := range c.propagators {
+		if err := p.Inject(id, writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CompositePropagator) InjectWithMaxAge(id string, maxAge time.Duration, writer http.ResponseWriter) error {
+	for _, p := range c.propagators {
+		var err error
+		if mp, ok := p.(MaxAgePropagator); ok {
+			err = mp.InjectWithMaxAge(id, maxAge, writer)
+		} else {
+			err = p.Inject(id, writer)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CompositePropagator) Extract(req *http.Request) (string, error) {
+	err := errNoPropagator
+	for _, p := range c.propagators {
+		var id string
+		id, err = p.Extract(req)
+		if err == nil {
+			return id, nil
+		}
+	}
+	return "", err
+}
+
+func (c *CompositePropagator) Remove(writer http.ResponseWriter) error {
+	for _, p := range c.propagators {
+		if err := p.Remove(writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,103 +2,380 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/redis/go-redis/v9"
+	"sort"
 	"time"
 	"web-frame/session"
 )
 
+const infoKey = session.ReservedKeyPrefix + "info"
+
 var (
-	errorKeyNotFound        = errors.New("session: key 找不到")
+	errorKeyNotFound        = session.ErrKeyNotFound
 	errorKeySessionNotFound = errors.New("session: session 找不到")
+	errorSessionExists      = errors.New("session: 新 id 对应的 session 已存在")
 )
 
+// 所有脚本都只访问一个 key，或者访问的 key 位于同一个 hash slot，可以在 redis cluster 中使用
+var (
+	// createScript 创建 session 并设置有效期，已经存在的 session 会被覆盖
+	createScript = redis.NewScript(`
+redis.call("del", KEYS[1])
+redis.call("hset", KEYS[1], ARGV[1], ARGV[2])
+redis.call("pexpire", KEYS[1], ARGV[3])
+return 1
+`)
+	// setScript 只在 session 存在时设置字段，避免创建没有有效期的 key
+	setScript = redis.NewScript(`
+if redis.call("exists", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("hset", KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+	// restoreScript 在新 key 不存在时写入所有字段并设置有效期
+	restoreScript = redis.NewScript(`
+if redis.call("exists", KEYS[1]) == 1 then
+	return -1
+end
+for i = 2, #ARGV, 2 do
+	redis.call("hset", KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call("pexpire", KEYS[1], ARGV[1])
+return 1
+`)
+	// renameScript 原子地把 session 迁移到新 key，两个 key 不在同一个 slot 时不能在 cluster 中使用
+	renameScript = redis.NewScript(`
+if redis.call("exists", KEYS[1]) == 0 then
+	return 0
+end
+if redis.call("exists", KEYS[2]) == 1 then
+	return -1
+end
+redis.call("rename", KEYS[1], KEYS[2])
+redis.call("pexpire", KEYS[2], ARGV[1])
+return 1
+`)
+	clearScript = redis.NewScript(`
+local fields = redis.call("hkeys", KEYS[1])
+for _, f in ipairs(fields) do
+	if string.sub(f, 1, string.len(ARGV[1])) ~= ARGV[1] then
+		redis.call("hdel", KEYS[1], f)
+	end
+end
+return 1
+`)
+)
+
+type StoreOption func(store *Store)
+
+// Store 把每个 session 保存为一个 hash，key 为 prefix{id}。
+// id 作为 hash tag，同一个 session 相关的 key 总是位于同一个 slot
 type Store struct {
 	client     redis.Cmdable
+	prefix     string
 	expiration time.Duration
+	codec      session.Codec
 }
 
-func NewStore(client redis.Cmdable) *Store {
-	return &Store{
+func NewStore(client redis.Cmdable, opts ...StoreOption) *Store {
+	res := &Store{
 		expiration: time.Minute * 15,
 		client:     client,
+		prefix:     "session:",
+		codec:      session.GobCodec{},
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func StoreWithExpiration(expiration time.Duration) StoreOption {
+	return func(store *Store) {
+		store.expiration = expiration
+	}
+}
+
+// StoreWithCodec 设置值的序列化方式，默认为 session.GobCodec
+func StoreWithCodec(codec session.Codec) StoreOption {
+	return func(store *Store) {
+		store.codec = codec
 	}
 }
 
+// StoreWithKeyPrefix 设置所有 key 的前缀，默认为 session:
+func StoreWithKeyPrefix(prefix string) StoreOption {
+	return func(store *Store) {
+		store.prefix = prefix
+	}
+}
+
+func (s *Store) Expiration() time.Duration {
+	return s.expiration
+}
+
+// Generate 用一个脚本同时创建 session 和设置有效期，并写入创建时间
 func (s *Store) Generate(ctx context.Context, id string) (session.Session, error) {
-	_, err := s.client.HSet(ctx, id, id, id).Result()
+	createdAt, err := s.codec.Marshal(time.Now().Unix())
 	if err != nil {
 		return nil, err
 	}
-	_, err = s.client.Expire(ctx, id, s.expiration).Result()
+	err = createScript.Run(ctx, s.client, []string{s.key(id)},
+		session.CreatedAtKey, createdAt, s.expiration.Milliseconds()).Err()
 	if err != nil {
 		return nil, err
 	}
-	return &Session{
-		id:     id,
-		client: s.client,
-	}, nil
+	return s.newSession(id), nil
 }
 
 func (s *Store) Refresh(ctx context.Context, id string) error {
-	ok, err := s.client.Expire(ctx, id, s.expiration).Result()
+	ok, err := s.client.PExpire(ctx, s.key(id), s.expiration).Result()
 	if err != nil {
 		return err
 	}
 	if !ok {
-		return errors.New("session: 该 id 对应 session 不存在")
+		return errorKeySessionNotFound
 	}
 	return nil
 }
 
 func (s *Store) Remove(ctx context.Context, id string) error {
-	_, err := s.client.Del(ctx, id).Result()
+	_, err := s.client.Del(ctx, s.key(id)).Result()
+	return err
+}
+
+// Regenerate 在单机 redis 中用 RENAME 原子地迁移数据。
+// 在 cluster 中新旧 key 通常位于不同的 slot，此时先复制数据再删除旧 key，迁移期间对旧 session 的修改可能丢失
+func (s *Store) Regenerate(ctx context.Context, oldID string, newID string) (session.Session, error) {
+	var (
+		res int
+		err error
+	)
+	if _, ok := s.client.(*redis.ClusterClient); ok {
+		res, err = s.copySession(ctx, oldID, newID)
+	} else {
+		res, err = renameScript.Run(ctx, s.client, []string{s.key(oldID), s.key(newID)},
+			s.expiration.Milliseconds()).Int()
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch res {
+	case 0:
+		return nil, errorKeySessionNotFound
+	case -1:
+		return nil, errorSessionExists
+	}
+	return s.newSession(newID), nil
+}
+
+func (s *Store) copySession(ctx context.Context, oldID string, newID string) (int, error) {
+	fields, err := s.client.HGetAll(ctx, s.key(oldID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	args := make([]any, 0, len(fields)*2+1)
+	args = append(args, s.expiration.Milliseconds())
+	for k, v := range fields {
+		args = append(args, k, v)
+	}
+	res, err := restoreScript.Run(ctx, s.client, []string{s.key(newID)}, args...).Int()
+	if err != nil || res != 1 {
+		return res, err
+	}
+	return res, s.client.Del(ctx, s.key(oldID)).Err()
+}
+
+// Index 把元数据保存在 session 自身的 hash 中，用户的 session id 保存在一个 set 中，
+// set 的有效期与 session 相同，每次更新元数据时续期
+func (s *Store) Index(ctx context.Context, info session.SessionInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	res, err := setScript.Run(ctx, s.client, []string{s.key(info.ID)}, infoKey, data).Int()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return errorKeySessionNotFound
+	}
+	key := s.userKey(info.UserID)
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, info.ID)
+		pipe.Expire(ctx, key, s.expiration)
+		return nil
+	})
+	return err
+}
+
+func (s *Store) List(ctx context.Context, userID string) ([]session.SessionInfo, error) {
+	key := s.userKey(userID)
+	ids, err := s.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.StringCmd, len(ids))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGet(ctx, s.key(id), infoKey)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	res := make([]session.SessionInfo, 0, len(ids))
+	var stale []any
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if errors.Is(err, redis.Nil) {
+			stale = append(stale, ids[i])
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var info session.SessionInfo
+		if err = json.Unmarshal(data, &info); err != nil {
+			return nil, err
+		}
+		res = append(res, info)
+	}
+	if len(stale) > 0 {
+		if err = s.client.SRem(ctx, key, stale...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+func (s *Store) Revoke(ctx context.Context, userID string, id string) error {
+	removed, err := s.client.SRem(ctx, s.userKey(userID), id).Result()
+	if err != nil || removed == 0 {
+		return err
+	}
+	return s.client.Del(ctx, s.key(id)).Err()
+}
+
+func (s *Store) RevokeAll(ctx context.Context, userID string) error {
+	key := s.userKey(userID)
+	ids, err := s.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, s.key(id))
+		}
+		pipe.Del(ctx, key)
+		return nil
+	})
 	return err
 }
 
+func (s *Store) key(id string) string {
+	return s.prefix + "{" + id + "}"
+}
+
+func (s *Store) userKey(userID string) string {
+	return s.prefix + "user:{" + userID + "}"
+}
+
 func (s *Store) Get(ctx context.Context, id string) (session.Session, error) {
-	cnt, err := s.client.Exists(ctx, id).Result()
+	cnt, err := s.client.Exists(ctx, s.key(id)).Result()
 	if err != nil {
 		return nil, err
 	}
 	if cnt != 1 {
 		return nil, errorKeySessionNotFound
 	}
+	return s.newSession(id), nil
+}
+
+func (s *Store) newSession(id string) *Session {
 	return &Session{
 		id:     id,
+		key:    s.key(id),
 		client: s.client,
-	}, nil
+		codec:  s.codec,
+	}
 }
 
 type Session struct {
 	client redis.Cmdable
+	codec  session.Codec
 	id     string
+	key    string
 }
 
 func (s *Session) Get(ctx context.Context, key string) (any, error) {
-	val, err := s.client.HGet(ctx, s.id, key).Result()
+	var val any
+	err := s.GetInto(ctx, key, &val)
 	return val, err
 }
 
+func (s *Session) GetInto(ctx context.Context, key string, dst any) error {
+	data, err := s.client.HGet(ctx, s.key, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return errorKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.codec.Unmarshal(data, dst)
+}
+
 func (s *Session) Set(ctx context.Context, key string, val any) error {
-	const lua = `
-if redis.call("exists", KEYS[1])
-then
-	return redis.call("hset", KEYS[1], ARGV[1], ARGV[2])
-else
-	return -1
-end
-`
-	res, err := s.client.Eval(ctx, lua, []string{s.id}, key, val).Int()
+	data, err := s.codec.Marshal(val)
 	if err != nil {
 		return err
 	}
-	if res < 0 {
-		return errorKeyNotFound
+	res, err := setScript.Run(ctx, s.client, []string{s.key}, key, data).Int()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return errorKeySessionNotFound
 	}
 	return nil
 }
 
+func (s *Session) Delete(ctx context.Context, key string) error {
+	return s.client.HDel(ctx, s.key, key).Err()
+}
+
+func (s *Session) Keys(ctx context.Context) ([]string, error) {
+	fields, err := s.client.HKeys(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if session.IsReservedKey(f) {
+			continue
+		}
+		keys = append(keys, f)
+	}
+	return keys, nil
+}
+
+func (s *Session) Clear(ctx context.Context) error {
+	return clearScript.Run(ctx, s.client, []string{s.key}, session.ReservedKeyPrefix).Err()
+}
+
 func (s *Session) ID() string {
 	return s.id
 }
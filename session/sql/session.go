@@ -0,0 +1,443 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"web-frame/session"
+)
+
+var (
+	errorKeyNotFound        = session.ErrKeyNotFound
+	errorKeySessionNotFound = errors.New("session: session 找不到")
+	errorSessionExists      = errors.New("session: 新 id 对应的 session 已存在")
+)
+
+// Dialect 描述不同数据库在占位符和建表语句上的差异
+type Dialect struct {
+	// Placeholder 返回第 i 个参数的占位符，i 从 1 开始
+	Placeholder func(i int) string
+	// Schema 返回创建指定表所需的语句
+	Schema func(table string) []string
+	// ForUpdate 追加在事务内的 SELECT 语句之后，用于锁住读取的行，避免并发的读改写丢失更新。
+	// SQLite 不支持这个语法，需要在打开数据库时使用立即事务，见 SQLite 的说明
+	ForUpdate string
+}
+
+var (
+	// SQLite 默认的 BEGIN 是延迟事务，先读后写的事务并发执行时会返回 database is locked，
+	// 因此打开数据库时需要使用立即事务，例如 mattn/go-sqlite3 的 file:sessions.db?_txlock=immediate
+	SQLite = Dialect{
+		Placeholder: questionPlaceholder,
+		Schema: func(table string) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	data BLOB NOT NULL,
+	expires_at BIGINT NOT NULL
+)`, table),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)`, table, table),
+			}
+		},
+	}
+	MySQL = Dialect{
+		Placeholder: questionPlaceholder,
+		ForUpdate:   " FOR UPDATE",
+		Schema: func(table string) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	data LONGBLOB NOT NULL,
+	expires_at BIGINT NOT NULL,
+	INDEX %s_expires_at (expires_at)
+)`, table, table),
+			}
+		},
+	}
+	Postgres = Dialect{
+		Placeholder: func(i int) string {
+			return "$" + strconv.Itoa(i)
+		},
+		ForUpdate: " FOR UPDATE",
+		Schema: func(table string) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	data BYTEA NOT NULL,
+	expires_at BIGINT NOT NULL
+)`, table),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)`, table, table),
+			}
+		},
+	}
+)
+
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+type StoreOption func(store *Store)
+
+// Store 把 session 保存在数据库的一张表里，所有的值编码后保存在 data 列，expires_at 为过期时间的毫秒时间戳
+type Store struct {
+	db            *sql.DB
+	dialect       Dialect
+	table         string
+	expiration    time.Duration
+	sweepInterval time.Duration
+	codec         session.Codec
+	now           func() time.Time
+	stop          chan struct{}
+	closeOnce     sync.Once
+}
+
+func NewStore(db *sql.DB, opts ...StoreOption) *Store {
+	res := &Store{
+		db:            db,
+		dialect:       SQLite,
+		table:         "sessions",
+		expiration:    time.Minute * 15,
+		sweepInterval: time.Minute,
+		codec:         session.GobCodec{},
+		now:           time.Now,
+		stop:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	if res.sweepInterval > 0 {
+		go res.sweepLoop()
+	}
+	return res
+}
+
+// StoreWithDialect 设置数据库方言，默认为 SQLite
+func StoreWithDialect(dialect Dialect) StoreOption {
+	return func(store *Store) {
+		store.dialect = dialect
+	}
+}
+
+// StoreWithTable 设置表名，默认为 sessions
+func StoreWithTable(table string) StoreOption {
+	return func(store *Store) {
+		store.table = table
+	}
+}
+
+func StoreWithExpiration(expiration time.Duration) StoreOption {
+	return func(store *Store) {
+		store.expiration = expiration
+	}
+}
+
+// StoreWithCodec 设置值的序列化方式，默认为 session.GobCodec
+func StoreWithCodec(codec session.Codec) StoreOption {
+	return func(store *Store) {
+		store.codec = codec
+	}
+}
+
+// StoreWithSweepInterval 设置后台删除过期 session 的间隔，默认一分钟，0 表示不在后台删除
+func StoreWithSweepInterval(interval time.Duration) StoreOption {
+	return func(store *Store) {
+		store.sweepInterval = interval
+	}
+}
+
+func (s *Store) Expiration() time.Duration {
+	return s.expiration
+}
+
+// Migrate 创建保存 session 的表，表已经存在时不做任何事情
+func (s *Store) Migrate(ctx context.Context) error {
+	for _, stmt := range s.dialect.Schema(s.table) {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sweep 删除所有过期的 session，返回删除的数量
+func (s *Store) Sweep(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.query("DELETE FROM %s WHERE expires_at <= %s"),
+		s.now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Close 停止后台删除，不会关闭 db
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
+
+func (s *Store) sweepLoop() {
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_, _ = s.Sweep(context.Background())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *Store) Generate(ctx context.Context, id string) (session.Session, error) {
+	data, err := encodeValues(map[string][]byte{})
+	if err != nil {
+		return nil, err
+	}
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		// 与其它 Store 一致，已经存在的 id 会被覆盖
+		_, err := tx.ExecContext(ctx, s.query("DELETE FROM %s WHERE id = %s"), id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.query("INSERT INTO %s (id, data, expires_at) VALUES (%s, %s, %s)"),
+			id, data, s.expiresAt())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.newSession(id), nil
+}
+
+func (s *Store) Refresh(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, s.query("UPDATE %s SET expires_at = %s WHERE id = %s AND expires_at > %s"),
+		s.expiresAt(), id, s.now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cnt == 0 {
+		return errorKeySessionNotFound
+	}
+	return nil
+}
+
+func (s *Store) Remove(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.query("DELETE FROM %s WHERE id = %s"), id)
+	return err
+}
+
+func (s *Store) Get(ctx context.Context, id string) (session.Session, error) {
+	if _, err := s.load(ctx, s.db, id, false); err != nil {
+		return nil, err
+	}
+	return s.newSession(id), nil
+}
+
+func (s *Store) Regenerate(ctx context.Context, oldID string, newID string) (session.Session, error) {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		values, err := s.load(ctx, tx, oldID, true)
+		if err != nil {
+			return err
+		}
+		if _, err = s.load(ctx, tx, newID, false); err == nil {
+			return errorSessionExists
+		}
+		data, err := encodeValues(values)
+		if err != nil {
+			return err
+		}
+		// 已经过期但还没被删除的记录会占用新 id
+		_, err = tx.ExecContext(ctx, s.query("DELETE FROM %s WHERE id = %s"), newID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.query("INSERT INTO %s (id, data, expires_at) VALUES (%s, %s, %s)"),
+			newID, data, s.expiresAt())
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.query("DELETE FROM %s WHERE id = %s"), oldID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.newSession(newID), nil
+}
+
+func (s *Store) newSession(id string) *Session {
+	return &Session{
+		id:    id,
+		store: s,
+	}
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// load 读取 session 的值，forUpdate 为 true 时在事务中锁住这一行直到事务结束
+func (s *Store) load(ctx context.Context, q queryer, id string, forUpdate bool) (map[string][]byte, error) {
+	var data []byte
+	err := q.QueryRowContext(ctx, s.selectQuery(forUpdate), id, s.now().UnixMilli()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errorKeySessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeValues(data)
+}
+
+func (s *Store) selectQuery(forUpdate bool) string {
+	query := s.query("SELECT data FROM %s WHERE id = %s AND expires_at > %s")
+	if forUpdate {
+		query += s.dialect.ForUpdate
+	}
+	return query
+}
+
+// update 在事务中锁住 session 所在的行，读取修改后写回，写回不会延长有效期
+func (s *Store) update(ctx context.Context, id string, fn func(values map[string][]byte)) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		values, err := s.load(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		fn(values)
+		data, err := encodeValues(values)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.query("UPDATE %s SET data = %s WHERE id = %s"), data, id)
+		return err
+	})
+}
+
+func (s *Store) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// query 把语句中的第一个 %s 替换为表名，其余的 %s 依次替换为占位符
+func (s *Store) query(format string) string {
+	args := []any{s.table}
+	for i := 1; i < countVerbs(format); i++ {
+		args = append(args, s.dialect.Placeholder(i))
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func countVerbs(format string) int {
+	cnt := 0
+	for i := 0; i+1 < len(format); i++ {
+		if format[i] == '%' && format[i+1] == 's' {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func (s *Store) expiresAt() int64 {
+	return s.now().Add(s.expiration).UnixMilli()
+}
+
+func encodeValues(values map[string][]byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(values)
+	return buf.Bytes(), err
+}
+
+func decodeValues(data []byte) (map[string][]byte, error) {
+	values := map[string][]byte{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+type Session struct {
+	store *Store
+	id    string
+}
+
+func (s *Session) Get(ctx context.Context, key string) (any, error) {
+	var val any
+	err := s.GetInto(ctx, key, &val)
+	return val, err
+}
+
+func (s *Session) GetInto(ctx context.Context, key string, dst any) error {
+	values, err := s.store.load(ctx, s.store.db, s.id, false)
+	if err != nil {
+		return err
+	}
+	data, ok := values[key]
+	if !ok {
+		return errorKeyNotFound
+	}
+	return s.store.codec.Unmarshal(data, dst)
+}
+
+func (s *Session) Set(ctx context.Context, key string, val any) error {
+	data, err := s.store.codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return s.store.update(ctx, s.id, func(values map[string][]byte) {
+		values[key] = data
+	})
+}
+
+func (s *Session) Delete(ctx context.Context, key string) error {
+	return s.store.update(ctx, s.id, func(values map[string][]byte) {
+		delete(values, key)
+	})
+}
+
+func (s *Session) Keys(ctx context.Context) ([]string, error) {
+	values, err := s.store.load(ctx, s.store.db, s.id, false)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if !session.IsReservedKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *Session) Clear(ctx context.Context) error {
+	return s.store.update(ctx, s.id, func(values map[string][]byte) {
+		for key := range values {
+			if !session.IsReservedKey(key) {
+				delete(values, key)
+			}
+		}
+	})
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
@@ -0,0 +1,95 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newStore(t *testing.T, opts ...StoreOption) *Store {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "sessions.db")+"?_txlock=immediate")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	store := NewStore(db, append([]StoreOption{StoreWithSweepInterval(0)}, opts...)...)
+	require.NoError(t, store.Migrate(context.Background()))
+	// 重复迁移不会出错
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+func TestStore_Sweep(t *testing.T) {
+	store := newStore(t, StoreWithExpiration(time.Minute), StoreWithTable("web_sessions"))
+	ctx := context.Background()
+
+	_, err := store.Generate(ctx, "old")
+	require.NoError(t, err)
+	store.now = func() time.Time {
+		return time.Now().Add(time.Second * 50)
+	}
+	_, err = store.Generate(ctx, "new")
+	require.NoError(t, err)
+
+	store.now = func() time.Time {
+		return time.Now().Add(time.Second * 70)
+	}
+	_, err = store.Get(ctx, "old")
+	assert.Equal(t, errorKeySessionNotFound, err)
+	cnt, err := store.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+	_, err = store.Get(ctx, "new")
+	assert.NoError(t, err)
+}
+
+func TestSession_ConcurrentSet(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	sess, err := store.Generate(ctx, "sess")
+	require.NoError(t, err)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = sess.Set(ctx, "key"+strconv.Itoa(i), i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err = range errs {
+		require.NoError(t, err)
+	}
+	// 并发的读改写不会丢失任何一次更新
+	keys, err := sess.Keys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, n)
+}
+
+func TestStore_Query(t *testing.T) {
+	store := &Store{table: "sessions", dialect: Postgres}
+	assert.Equal(t, "UPDATE sessions SET data = $1 WHERE id = $2",
+		store.query("UPDATE %s SET data = %s WHERE id = %s"))
+	store.dialect = MySQL
+	assert.Equal(t, "DELETE FROM sessions WHERE id = ?", store.query("DELETE FROM %s WHERE id = %s"))
+}
+
+func TestStore_SelectQuery(t *testing.T) {
+	store := &Store{table: "sessions", dialect: Postgres}
+	assert.Equal(t, "SELECT data FROM sessions WHERE id = $1 AND expires_at > $2 FOR UPDATE", store.selectQuery(true))
+	assert.Equal(t, "SELECT data FROM sessions WHERE id = $1 AND expires_at > $2", store.selectQuery(false))
+	store.dialect = MySQL
+	assert.Equal(t, "SELECT data FROM sessions WHERE id = ? AND expires_at > ? FOR UPDATE", store.selectQuery(true))
+	store.dialect = SQLite
+	assert.Equal(t, "SELECT data FROM sessions WHERE id = ? AND expires_at > ?", store.selectQuery(true))
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/alicebob/miniredis/v2"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+	"web-frame/session"
+	"web-frame/session/file"
+	"web-frame/session/memory"
+	sessredis "web-frame/session/redis"
+	sesssql "web-frame/session/sql"
+)
+
+func TestMemoryStore(t *testing.T) {
+	RunStoreSuite(t, func(t *testing.T) session.Store {
+		return memory.NewStore(time.Minute)
+	})
+}
+
+func TestRedisStore(t *testing.T) {
+	codecs := map[string]session.Codec{
+		"gob":     session.GobCodec{},
+		"json":    session.JSONCodec{},
+		"msgpack": session.MsgpackCodec{},
+	}
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			RunStoreSuite(t, func(t *testing.T) session.Store {
+				mr := miniredis.RunT(t)
+				client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+				return sessredis.NewStore(client, sessredis.StoreWithCodec(codec))
+			})
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	RunStoreSuite(t, func(t *testing.T) session.Store {
+		store, err := file.NewStore(t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = store.Close()
+		})
+		return store
+	})
+}
+
+func TestSQLStore(t *testing.T) {
+	RunStoreSuite(t, func(t *testing.T) session.Store {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "sessions.db"))
+		require.NoError(t, err)
+		store := sesssql.NewStore(db)
+		t.Cleanup(func() {
+			_ = store.Close()
+			_ = db.Close()
+		})
+		require.NoError(t, store.Migrate(context.Background()))
+		return store
+	})
+}
@@ -0,0 +1,40 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"web-frame/session"
+	"web-frame/session/memory"
+)
+
+func TestFlashes(t *testing.T) {
+	ctx := context.Background()
+	sess, err := memory.NewStore(time.Minute).Generate(ctx, "sess-1")
+	require.NoError(t, err)
+
+	flashes, err := session.Flashes(ctx, sess)
+	require.NoError(t, err)
+	assert.Empty(t, flashes)
+
+	require.NoError(t, session.AddFlash(ctx, sess, "success", "保存成功"))
+	require.NoError(t, session.AddFlash(ctx, sess, "warning", "邮箱未验证"))
+	// 消息不会出现在普通的 key 里
+	keys, err := sess.Keys(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	flashes, err = session.Flashes(ctx, sess)
+	require.NoError(t, err)
+	assert.Equal(t, []session.FlashMessage{
+		{Kind: "success", Message: "保存成功"},
+		{Kind: "warning", Message: "邮箱未验证"},
+	}, flashes)
+
+	// 读取之后消息被删除
+	flashes, err = session.Flashes(ctx, sess)
+	require.NoError(t, err)
+	assert.Empty(t, flashes)
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"web-frame"
+	"web-frame/session"
+	"web-frame/session/cookie"
+	"web-frame/session/memory"
+)
+
+func newManagerServer(m *session.Manager) *web_frame.HTTPServer {
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(m.Middleware()))
+	server.Post("/login", func(ctx *web_frame.Context) {
+		sess, err := m.InitSession(ctx)
+		if err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			return
+		}
+		_ = sess.Set(ctx.Req.Context(), "nickname", "bill")
+		ctx.RespStatusCode = http.StatusOK
+	})
+	server.Get("/user", func(ctx *web_frame.Context) {
+		sess, err := m.GetSession(ctx)
+		if err != nil {
+			ctx.RespStatusCode = http.StatusUnauthorized
+			return
+		}
+		val, _ := sess.Get(ctx.Req.Context(), "nickname")
+		ctx.RespData = []byte(val.(string))
+	})
+	server.Get("/health", func(ctx *web_frame.Context) {
+		ctx.RespData = []byte("ok")
+	})
+	return server
+}
+
+func TestManager_SlidingExpiration(t *testing.T) {
+	store := memory.NewStore(time.Minute * 15)
+	m := &session.Manager{
+		Propagator: cookie.NewPropagator(),
+		Store:      store,
+		CtxSessKey: "sessKey",
+	}
+	server := newManagerServer(m)
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/login", nil))
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, 900, cookies[0].MaxAge)
+
+	// 没有访问 session 的请求不会加载和续期
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Empty(t, resp.Result().Cookies())
+
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, "bill", resp.Body.String())
+	refreshed := resp.Result().Cookies()
+	require.Len(t, refreshed, 1)
+	assert.Equal(t, cookies[0].Value, refreshed[0].Value)
+	assert.Equal(t, 900, refreshed[0].MaxAge)
+}
+
+func TestManager_MaxLifetime(t *testing.T) {
+	store := memory.NewStore(time.Minute * 15)
+	m := &session.Manager{
+		Propagator:  cookie.NewPropagator(),
+		Store:       store,
+		CtxSessKey:  "sessKey",
+		MaxLifetime: time.Minute * 10,
+	}
+	server := newManagerServer(m)
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/login", nil))
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	// cookie 的有效期不会超过剩余的最长有效期
+	assert.InDelta(t, 600, cookies[0].MaxAge, 1)
+
+	sess, err := store.Get(context.Background(), cookies[0].Value)
+	require.NoError(t, err)
+	require.NoError(t, sess.Set(context.Background(), session.ReservedKeyPrefix+"created_at", time.Now().Add(-time.Minute*11).Unix()))
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	removed := resp.Result().Cookies()
+	require.Len(t, removed, 1)
+	assert.Equal(t, -1, removed[0].MaxAge)
+	_, err = store.Get(context.Background(), cookies[0].Value)
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"web-frame/session"
+	"web-frame/session/cookie"
+	"web-frame/session/header"
+	"web-frame/session/memory"
+)
+
+func TestCompositePropagator(t *testing.T) {
+	m := &session.Manager{
+		Propagator: session.NewCompositePropagator(
+			cookie.NewPropagator(),
+			header.NewPropagator(header.PropagatorWithHeaderName("Authorization"), header.PropagatorWithBearer()),
+		),
+		Store:      memory.NewStore(time.Minute * 15),
+		CtxSessKey: "sessKey",
+	}
+	server := newManagerServer(m)
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/login", nil))
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, 900, cookies[0].MaxAge)
+	token := resp.Header().Get("Authorization")
+	assert.Equal(t, "Bearer "+cookies[0].Value, token)
+
+	// 浏览器使用 cookie
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, "bill", resp.Body.String())
+
+	// API 客户端使用请求头
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", token)
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, "bill", resp.Body.String())
+
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
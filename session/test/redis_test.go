@@ -0,0 +1,52 @@
+package test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"web-frame/session"
+	sessredis "web-frame/session/redis"
+)
+
+func TestRedisStore_KeyPrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := sessredis.NewStore(client, sessredis.StoreWithKeyPrefix("app:sess:"),
+		sessredis.StoreWithExpiration(time.Minute))
+	ctx := context.Background()
+
+	sess, err := store.Generate(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app:sess:{sess-1}"}, mr.Keys())
+	// 创建时就有有效期，并且只有创建时间一个字段
+	assert.Equal(t, time.Minute, mr.TTL("app:sess:{sess-1}"))
+	fields, err := mr.HKeys("app:sess:{sess-1}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{session.CreatedAtKey}, fields)
+	createdAt, err := session.GetAs[int64](ctx, sess, session.CreatedAtKey)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Unix(), createdAt, 1)
+
+	require.NoError(t, sess.Set(ctx, "name", "bill"))
+	assert.Equal(t, time.Minute, mr.TTL("app:sess:{sess-1}"))
+
+	// session 不存在时不会创建没有有效期的 key
+	require.NoError(t, store.Remove(ctx, "sess-1"))
+	assert.Error(t, sess.Set(ctx, "name", "bill"))
+	assert.Empty(t, mr.Keys())
+}
+
+func TestRedisStore_Cluster(t *testing.T) {
+	RunStoreSuite(t, func(t *testing.T) session.Store {
+		mr := miniredis.RunT(t)
+		client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+		return sessredis.NewStore(client)
+	})
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"web-frame"
+	"web-frame/session"
+	"web-frame/session/cookie"
+	"web-frame/session/memory"
+	sessredis "web-frame/session/redis"
+)
+
+func TestManager_RegenerateSession(t *testing.T) {
+	store := memory.NewStore(time.Minute * 15)
+	m := &session.Manager{
+		Propagator: cookie.NewPropagator(),
+		Store:      store,
+		CtxSessKey: "sessKey",
+	}
+	server := newManagerServer(m)
+	server.Post("/elevate", func(ctx *web_frame.Context) {
+		sess, err := m.RegenerateSession(ctx)
+		if err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			return
+		}
+		ctx.RespData = []byte(sess.ID())
+	})
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/login", nil))
+	oldCookie := resp.Result().Cookies()[0]
+
+	req := httptest.NewRequest(http.MethodPost, "/elevate", nil)
+	req.AddCookie(oldCookie)
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	newCookie := cookies[0]
+	assert.NotEqual(t, oldCookie.Value, newCookie.Value)
+	assert.Equal(t, newCookie.Value, resp.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(newCookie)
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, "bill", resp.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(oldCookie)
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestRedisStore_Regenerate(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := sessredis.NewStore(client, sessredis.StoreWithExpiration(time.Minute))
+	ctx := context.Background()
+
+	sess, err := store.Generate(ctx, "old")
+	require.NoError(t, err)
+	require.NoError(t, sess.Set(ctx, "nickname", "bill"))
+
+	newSess, err := store.Regenerate(ctx, "old", "new")
+	require.NoError(t, err)
+	assert.Equal(t, "new", newSess.ID())
+	val, err := newSess.Get(ctx, "nickname")
+	require.NoError(t, err)
+	assert.Equal(t, "bill", val)
+	assert.Equal(t, time.Minute, mr.TTL("session:{new}"))
+
+	_, err = store.Get(ctx, "old")
+	assert.Error(t, err)
+	_, err = store.Regenerate(ctx, "old", "other")
+	assert.Error(t, err)
+
+	_, err = store.Generate(ctx, "another")
+	require.NoError(t, err)
+	_, err = store.Regenerate(ctx, "new", "another")
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"context"
+	"encoding/gob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+	"web-frame/session"
+)
+
+type User struct {
+	Name string
+	Age  int
+}
+
+func init() {
+	gob.Register(User{})
+}
+
+// RunStoreSuite 是所有 session.Store 实现都需要通过的一致性测试
+func RunStoreSuite(t *testing.T, newStore func(t *testing.T) session.Store) {
+	ctx := context.Background()
+
+	t.Run("generate and get", func(t *testing.T) {
+		store := newStore(t)
+		sess, err := store.Generate(ctx, "sess-1")
+		require.NoError(t, err)
+		assert.Equal(t, "sess-1", sess.ID())
+
+		got, err := store.Get(ctx, "sess-1")
+		require.NoError(t, err)
+		assert.Equal(t, "sess-1", got.ID())
+
+		_, err = store.Get(ctx, "not-exist")
+		assert.Error(t, err)
+	})
+
+	t.Run("values round trip", func(t *testing.T) {
+		store := newStore(t)
+		sess, err := store.Generate(ctx, "sess-1")
+		require.NoError(t, err)
+		require.NoError(t, sess.Set(ctx, "name", "bill"))
+		require.NoError(t, sess.Set(ctx, "age", 18))
+		require.NoError(t, sess.Set(ctx, "user", User{Name: "bill", Age: 18}))
+
+		sess, err = store.Get(ctx, "sess-1")
+		require.NoError(t, err)
+
+		name, err := session.GetAs[string](ctx, sess, "name")
+		require.NoError(t, err)
+		assert.Equal(t, "bill", name)
+		age, err := session.GetAs[int](ctx, sess, "age")
+		require.NoError(t, err)
+		assert.Equal(t, 18, age)
+		user, err := session.GetAs[User](ctx, sess, "user")
+		require.NoError(t, err)
+		assert.Equal(t, User{Name: "bill", Age: 18}, user)
+
+		_, err = sess.Get(ctx, "not-exist")
+		assert.Error(t, err)
+	})
+
+	t.Run("delete keys clear", func(t *testing.T) {
+		store := newStore(t)
+		sess, err := store.Generate(ctx, "sess-1")
+		require.NoError(t, err)
+		require.NoError(t, sess.Set(ctx, "a", "1"))
+		require.NoError(t, sess.Set(ctx, "b", "2"))
+		require.NoError(t, sess.Set(ctx, "c", "3"))
+		require.NoError(t, sess.Set(ctx, session.ReservedKeyPrefix+"internal", "x"))
+
+		keys, err := sess.Keys(ctx)
+		require.NoError(t, err)
+		sort.Strings(keys)
+		assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+		require.NoError(t, sess.Delete(ctx, "a"))
+		_, err = sess.Get(ctx, "a")
+		assert.Error(t, err)
+		keys, err = sess.Keys(ctx)
+		require.NoError(t, err)
+		sort.Strings(keys)
+		assert.Equal(t, []string{"b", "c"}, keys)
+
+		require.NoError(t, sess.Clear(ctx))
+		keys, err = sess.Keys(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+		internal, err := session.GetAs[string](ctx, sess, session.ReservedKeyPrefix+"internal")
+		require.NoError(t, err)
+		assert.Equal(t, "x", internal)
+
+		// 清空之后 session 仍然存在
+		_, err = store.Get(ctx, "sess-1")
+		require.NoError(t, err)
+	})
+
+	t.Run("refresh and remove", func(t *testing.T) {
+		store := newStore(t)
+		_, err := store.Generate(ctx, "sess-1")
+		require.NoError(t, err)
+		require.NoError(t, store.Refresh(ctx, "sess-1"))
+		assert.Error(t, store.Refresh(ctx, "not-exist"))
+
+		require.NoError(t, store.Remove(ctx, "sess-1"))
+		_, err = store.Get(ctx, "sess-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("regenerate", func(t *testing.T) {
+		store := newStore(t)
+		r, ok := store.(session.Regenerator)
+		if !ok {
+			t.Skip("store 不支持 Regenerate")
+		}
+		sess, err := store.Generate(ctx, "sess-1")
+		require.NoError(t, err)
+		require.NoError(t, sess.Set(ctx, "name", "bill"))
+
+		newSess, err := r.Regenerate(ctx, "sess-1", "sess-2")
+		require.NoError(t, err)
+		assert.Equal(t, "sess-2", newSess.ID())
+		name, err := session.GetAs[string](ctx, newSess, "name")
+		require.NoError(t, err)
+		assert.Equal(t, "bill", name)
+		_, err = store.Get(ctx, "sess-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("flash", func(t *testing.T) {
+		store := newStore(t)
+		sess, err := store.Generate(ctx, "sess-1")
+		require.NoError(t, err)
+		require.NoError(t, session.AddFlash(ctx, sess, "success", "保存成功"))
+		flashes, err := session.Flashes(ctx, sess)
+		require.NoError(t, err)
+		assert.Equal(t, []session.FlashMessage{{Kind: "success", Message: "保存成功"}}, flashes)
+		flashes, err = session.Flashes(ctx, sess)
+		require.NoError(t, err)
+		assert.Empty(t, flashes)
+	})
+}
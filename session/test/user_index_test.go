@@ -0,0 +1,169 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"web-frame"
+	"web-frame/session"
+	"web-frame/session/cookie"
+	"web-frame/session/memory"
+	sessredis "web-frame/session/redis"
+)
+
+func newUserIndexServer(m *session.Manager) *web_frame.HTTPServer {
+	server := web_frame.NewHTTPServer(web_frame.ServerWithMiddleware(m.Middleware()))
+	server.Post("/login/:user", func(ctx *web_frame.Context) {
+		if _, err := m.InitSession(ctx); err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			return
+		}
+		if err := m.BindUser(ctx, ctx.PathParams["user"]); err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+		}
+	})
+	server.Get("/sessions/:user", func(ctx *web_frame.Context) {
+		infos, err := m.ListUserSessions(ctx, ctx.PathParams["user"])
+		if err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			return
+		}
+		_ = ctx.RespJson(http.StatusOK, infos)
+	})
+	server.Delete("/sessions/:user/:id", func(ctx *web_frame.Context) {
+		if err := m.RevokeUserSession(ctx, ctx.PathParams["user"], ctx.PathParams["id"]); err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+		}
+	})
+	server.Delete("/sessions/:user", func(ctx *web_frame.Context) {
+		if err := m.RevokeUserSessions(ctx, ctx.PathParams["user"]); err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+		}
+	})
+	server.Get("/whoami", func(ctx *web_frame.Context) {
+		if _, err := m.GetSession(ctx); err != nil {
+			ctx.RespStatusCode = http.StatusUnauthorized
+		}
+	})
+	return server
+}
+
+func TestManager_UserIndex(t *testing.T) {
+	testCases := []struct {
+		name     string
+		newStore func(t *testing.T) session.Store
+	}{
+		{
+			name: "memory",
+			newStore: func(t *testing.T) session.Store {
+				return memory.NewStore(time.Minute * 15)
+			},
+		},
+		{
+			name: "redis",
+			newStore: func(t *testing.T) session.Store {
+				mr := miniredis.RunT(t)
+				return sessredis.NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &session.Manager{
+				Propagator: cookie.NewPropagator(),
+				Store:      tc.newStore(t),
+				CtxSessKey: "sessKey",
+			}
+			server := newUserIndexServer(m)
+			serve := func(method string, path string, c *http.Cookie, userAgent string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, nil)
+				req.RemoteAddr = "10.0.0.1:1234"
+				req.Header.Set("User-Agent", userAgent)
+				if c != nil {
+					req.AddCookie(c)
+				}
+				resp := httptest.NewRecorder()
+				server.ServeHTTP(resp, req)
+				return resp
+			}
+			login := func(user string, userAgent string) *http.Cookie {
+				resp := serve(http.MethodPost, "/login/"+user, nil, userAgent)
+				require.Equal(t, http.StatusOK, resp.Code)
+				return resp.Result().Cookies()[0]
+			}
+			list := func(user string) map[string]session.SessionInfo {
+				resp := serve(http.MethodGet, "/sessions/"+user, nil, "")
+				require.Equal(t, http.StatusOK, resp.Code)
+				var infos []session.SessionInfo
+				require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &infos))
+				res := make(map[string]session.SessionInfo, len(infos))
+				for _, info := range infos {
+					res[info.ID] = info
+				}
+				return res
+			}
+
+			laptop := login("bill", "laptop")
+			phone := login("bill", "phone")
+			other := login("alice", "laptop")
+
+			infos := list("bill")
+			require.Len(t, infos, 2)
+			info := infos[laptop.Value]
+			assert.Equal(t, "laptop", info.UserAgent)
+			assert.Equal(t, "10.0.0.1", info.IP)
+			assert.Equal(t, "bill", info.UserID)
+			assert.False(t, info.CreatedAt.IsZero())
+			assert.False(t, info.LastSeen.IsZero())
+			assert.Equal(t, "phone", infos[phone.Value].UserAgent)
+
+			// 不能注销其他用户的 session
+			resp := serve(http.MethodDelete, "/sessions/bill/"+other.Value, nil, "")
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/whoami", other, "").Code)
+
+			// 在笔记本上注销手机的登录
+			resp = serve(http.MethodDelete, "/sessions/bill/"+phone.Value, laptop, "laptop")
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/whoami", phone, "").Code)
+			infos = list("bill")
+			require.Len(t, infos, 1)
+			assert.Contains(t, infos, laptop.Value)
+
+			// 退出所有设备，当前设备的 cookie 也会被删除
+			phone = login("bill", "phone")
+			resp = serve(http.MethodDelete, "/sessions/bill", laptop, "laptop")
+			require.Equal(t, http.StatusOK, resp.Code)
+			cookies := resp.Result().Cookies()
+			require.Len(t, cookies, 1)
+			assert.Equal(t, -1, cookies[0].MaxAge)
+			assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/whoami", laptop, "").Code)
+			assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/whoami", phone, "").Code)
+			assert.Empty(t, list("bill"))
+			assert.Len(t, list("alice"), 1)
+		})
+	}
+}
+
+func TestManager_UserIndexNotSupported(t *testing.T) {
+	m := &session.Manager{
+		Propagator: cookie.NewPropagator(),
+		Store:      notIndexedStore{Store: memory.NewStore(time.Minute)},
+		CtxSessKey: "sessKey",
+	}
+	server := newUserIndexServer(m)
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/sessions/bill", nil))
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+}
+
+type notIndexedStore struct {
+	session.Store
+}
@@ -2,9 +2,21 @@ package session
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 )
 
+// ReservedKeyPrefix 是框架内部使用的 key 前缀，Keys 和 Clear 会忽略这些 key
+const ReservedKeyPrefix = "_sess."
+
+// CreatedAtKey 保存 session 创建时间的 unix 时间戳，类型为 int64
+const CreatedAtKey = ReservedKeyPrefix + "created_at"
+
+// ErrKeyNotFound 是所有 Session 实现在 key 不存在时返回的错误
+var ErrKeyNotFound = errors.New("session: key 找不到")
+
 type Store interface {
 	Generate(ctx context.Context, id string) (Session, error)
 	Refresh(ctx context.Context, id string) error
@@ -15,6 +27,9 @@ type Store interface {
 type Session interface {
 	Get(ctx context.Context, key string) (any, error)
 	Set(ctx context.Context, key string, val any) error
+	Delete(ctx context.Context, key string) error
+	Keys(ctx context.Context) ([]string, error)
+	Clear(ctx context.Context) error
 	ID() string
 }
 
@@ -23,3 +38,44 @@ type Propagator interface {
 	Extract(req *http.Request) (string, error)
 	Remove(writer http.ResponseWriter) error
 }
+
+// ExpirationStore 由能够告知 session 有效期的 Store 实现，Manager 据此设置 cookie 的 Max-Age
+type ExpirationStore interface {
+	Expiration() time.Duration
+}
+
+// MaxAgePropagator 由能够指定有效期的 Propagator 实现
+type MaxAgePropagator interface {
+	InjectWithMaxAge(id string, maxAge time.Duration, writer http.ResponseWriter) error
+}
+
+// Regenerator 由能够把 session 数据原子地迁移到新 id 的 Store 实现，迁移后旧 id 立即失效
+type Regenerator interface {
+	Regenerate(ctx context.Context, oldID string, newID string) (Session, error)
+}
+
+func IsReservedKey(key string) bool {
+	return strings.HasPrefix(key, ReservedKeyPrefix)
+}
+
+// SessionInfo 是用户某个 session 的元数据，用于列出用户在各个设备上的登录
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+}
+
+// UserIndex 由能够按用户查找 session 的 Store 实现
+type UserIndex interface {
+	// Index 把 session 关联到 info.UserID 并更新元数据，session 不存在时返回错误
+	Index(ctx context.Context, info SessionInfo) error
+	// List 返回用户所有仍然有效的 session
+	List(ctx context.Context, userID string) ([]SessionInfo, error)
+	// Revoke 删除用户的某个 session，不属于该用户的 session 不受影响
+	Revoke(ctx context.Context, userID string, id string) error
+	// RevokeAll 删除用户的所有 session
+	RevokeAll(ctx context.Context, userID string) error
+}
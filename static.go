@@ -0,0 +1,833 @@
+package web_frame
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errorNoOverlap = errors.New("web: range 超出文件范围")
+	errorIsDir     = errors.New("web: 目标是一个目录")
+)
+
+type StaticResourceHandlerOption func(handler *StaticResourceHandler)
+
+// StaticResourceHandler 从 fs 中读取静态文件，不超过 maxSize 的文件会缓存在内存中，
+// 缓存的总大小不超过 cacheSize，更大的文件每次从 fs 中流式读取。支持 ETag、Last-Modified 条件请求以及 Range 请求。
+// 文件名来自路径参数 file，注册的路由没有 file 参数时对应 fs 的根目录
+type StaticResourceHandler struct {
+	fs fs.FS
+	// root 是 fs 对应的目录，用于检查符号链接，fs 不是本地目录时为空
+	root          string
+	policy        PathPolicy
+	cache         *staticCache
+	cacheSize     int64
+	cacheTTL      time.Duration
+	checkInterval time.Duration
+	// extContentTypeMap 按扩展名（不带点）覆盖自动识别的 Content-Type
+	extContentTypeMap map[string]string
+	// charset 添加到没有声明字符集的文本类型上
+	charset string
+	// cacheControl 按扩展名设置 Cache-Control，* 对应没有单独配置的扩展名
+	cacheControl map[string]string
+	maxSize      int
+	// compressMinSize 达到这个大小的可压缩文件会被动态 gzip 压缩，小于 0 表示不压缩
+	compressMinSize int
+	// indexFiles 请求目录时依次查找的文件
+	indexFiles []string
+	// dirListing 为 true 时，没有索引文件的目录返回文件列表
+	dirListing bool
+}
+
+// staticFile 是缓存的文件内容，etag 由内容计算得到。
+// variants 保存同一个文件的压缩版本，key 为 Content-Encoding
+type staticFile struct {
+	// name 是文件在 fs 中的路径，动态压缩的版本为空
+	name string
+	data []byte
+	// stream 为 true 时文件超过了 maxSize，data 为空，响应时从 fs 中流式读取，
+	// etag 由修改时间和大小计算得到
+	stream   bool
+	length   int64
+	modTime  time.Time
+	etag     string
+	encoding string
+	// contentType 是原文件的类型，压缩版本不单独记录
+	contentType string
+	variants    map[string]*staticFile
+}
+
+// precompressed 是预先压缩好的文件的后缀，按照优先级排列
+var precompressed = []struct {
+	encoding string
+	suffix   string
+}{
+	{encoding: "br", suffix: ".br"},
+	{encoding: "gzip", suffix: ".gz"},
+}
+
+// NewStaticResourceHandler 创建读取 dir 目录的 StaticResourceHandler
+func NewStaticResourceHandler(dir string, opts ...StaticResourceHandlerOption) (*StaticResourceHandler, error) {
+	res, err := NewStaticResourceHandlerFS(os.DirFS(dir), opts...)
+	if err != nil {
+		return nil, err
+	}
+	res.root = dir
+	return res, nil
+}
+
+// NewStaticResourceHandlerFS 创建读取任意 fs.FS 的 StaticResourceHandler，例如 embed.FS。
+// embed.FS 中的文件没有修改时间，此时只通过 ETag 判断缓存是否有效
+func NewStaticResourceHandlerFS(fsys fs.FS, opts ...StaticResourceHandlerOption) (*StaticResourceHandler, error) {
+	res := &StaticResourceHandler{
+		fs:                fsys,
+		cacheSize:         1024 * 1024 * 64,
+		checkInterval:     time.Second,
+		extContentTypeMap: map[string]string{},
+		charset:           "utf-8",
+		cacheControl:      map[string]string{},
+		maxSize:           1024 * 1024 * 10,
+		compressMinSize:   1024,
+		indexFiles:        []string{"index.html"},
+	}
+
+	for _, opt := range opts {
+		opt(res)
+	}
+	res.cache = newStaticCache(res.cacheSize, res.cacheTTL, res.checkInterval, res.unchanged)
+
+	return res, nil
+}
+
+// CacheStats 返回缓存的命中率、占用的内存等统计数据
+func (s *StaticResourceHandler) CacheStats() StaticCacheStats {
+	return s.cache.stats()
+}
+
+func (s *StaticResourceHandler) Handle(ctx *Context) {
+	name, err := s.name(ctx)
+	if err != nil {
+		respPathError(ctx, err)
+		return
+	}
+	f, err := s.load(name)
+	if errors.Is(err, errorIsDir) {
+		s.serveDir(ctx, name)
+		return
+	}
+	s.serveFile(ctx, name, f, err)
+}
+
+// name 把路径参数 file 转换为 fs.FS 中的文件名，没有 file 参数时对应根目录
+func (s *StaticResourceHandler) name(ctx *Context) (string, error) {
+	file, err := ctx.PathValue("file")
+	if err != nil {
+		file = "."
+	}
+	name, err := s.policy.Check(file)
+	if err != nil {
+		return "", err
+	}
+	return name, s.checkSymlinks(name)
+}
+
+// checkSymlinks 在 fs 是本地目录时按照 policy 检查符号链接。
+// 索引文件和预压缩文件也要检查，os.DirFS 打开文件时会跟随符号链接
+func (s *StaticResourceHandler) checkSymlinks(name string) error {
+	if s.root == "" || s.policy.Symlinks == SymlinkFollow {
+		return nil
+	}
+	_, err := s.policy.Join(s.root, name)
+	return err
+}
+
+func (s *StaticResourceHandler) serveFile(ctx *Context, name string, f *staticFile, err error) {
+	if isPathError(err) {
+		respPathError(ctx, err)
+		return
+	}
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errorIsDir) {
+		ctx.RespStatusCode = http.StatusNotFound
+		ctx.RespData = []byte("文件不存在")
+		return
+	}
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("服务器内部错误")
+		return
+	}
+
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	contentType := f.contentType
+	header := ctx.Resp.Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	if len(f.variants) > 0 {
+		header.Add("Vary", "Accept-Encoding")
+		f = f.negotiate(ctx.Req.Header.Get("Accept-Encoding"))
+	}
+	if f.encoding != "" {
+		header.Set("Content-Encoding", f.encoding)
+	}
+	header.Set("ETag", f.etag)
+	if !f.modTime.IsZero() {
+		header.Set("Last-Modified", f.modTime.UTC().Format(http.TimeFormat))
+	}
+	if policy, ok := s.cacheControl[ext]; ok {
+		header.Set("Cache-Control", policy)
+	} else if policy, ok = s.cacheControl["*"]; ok {
+		header.Set("Cache-Control", policy)
+	}
+	if f.notModified(ctx.Req) {
+		ctx.RespStatusCode = http.StatusNotModified
+		return
+	}
+	header.Set("Accept-Ranges", "bytes")
+	if f.stream {
+		s.stream(ctx, f, contentType)
+		return
+	}
+	f.serve(ctx, contentType)
+}
+
+// stream 直接把文件写入响应，Range 和 If-Range 交给 http.ServeContent 处理
+func (s *StaticResourceHandler) stream(ctx *Context, f *staticFile, contentType string) {
+	file, err := s.fs.Open(f.name)
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("服务器内部错误")
+		return
+	}
+	defer file.Close()
+	header := ctx.Resp.Header()
+	header.Set("Content-Type", contentType)
+	rs, ok := file.(io.ReadSeeker)
+	if !ok {
+		// 不支持 Seek 的文件忽略 Range，返回整个文件
+		header.Del("Accept-Ranges")
+		header.Set("Content-Length", strconv.FormatInt(f.length, 10))
+		ctx.Resp.WriteHeader(http.StatusOK)
+		_, _ = io.Copy(ctx.Resp, file)
+		return
+	}
+	http.ServeContent(ctx.Resp, ctx.Req, "", f.modTime, rs)
+}
+
+// serveDir 依次查找目录下的索引文件，都不存在时按照配置返回目录列表。
+// 请求路径不以 / 结尾时先重定向，保证页面中的相对链接指向目录内部
+func (s *StaticResourceHandler) serveDir(ctx *Context, name string) {
+	if !strings.HasSuffix(ctx.Req.URL.Path, "/") {
+		target := ctx.Req.URL.Path + "/"
+		if ctx.Req.URL.RawQuery != "" {
+			target += "?" + ctx.Req.URL.RawQuery
+		}
+		ctx.Resp.Header().Set("Location", target)
+		ctx.RespStatusCode = http.StatusMovedPermanently
+		return
+	}
+	for _, index := range s.indexFiles {
+		indexName := path.Join(name, index)
+		f, err := s.load(indexName)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errorIsDir) {
+			continue
+		}
+		s.serveFile(ctx, indexName, f, err)
+		return
+	}
+	if !s.dirListing {
+		ctx.RespStatusCode = http.StatusNotFound
+		ctx.RespData = []byte("文件不存在")
+		return
+	}
+	all, err := fs.ReadDir(s.fs, name)
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("服务器内部错误")
+		return
+	}
+	// 不列出按照 policy 不能访问的文件
+	entries := make([]fs.DirEntry, 0, len(all))
+	for _, entry := range all {
+		if _, err = s.policy.Check(path.Join(name, entry.Name())); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	var buf bytes.Buffer
+	if err = dirListingTemplate.Execute(&buf, dirListing{Name: name, Entries: entries}); err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("服务器内部错误")
+		return
+	}
+	ctx.Resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	ctx.Resp.Header().Set("X-Content-Type-Options", "nosniff")
+	ctx.RespStatusCode = http.StatusOK
+	ctx.RespData = buf.Bytes()
+}
+
+type dirListing struct {
+	Name    string
+	Entries []fs.DirEntry
+}
+
+var dirListingTemplate = template.Must(template.New("dir").Funcs(template.FuncMap{
+	"href": func(entry fs.DirEntry) string {
+		href := (&url.URL{Path: entry.Name()}).String()
+		if entry.IsDir() {
+			href += "/"
+		}
+		return href
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{ .Name }}</title></head>
+<body>
+<h1>{{ .Name }}</h1>
+<ul>
+{{- range .Entries }}
+<li><a href="{{ href . }}">{{ .Name }}{{ if .IsDir }}/{{ end }}</a></li>
+{{- end }}
+</ul>
+</body>
+</html>
+`))
+
+// load 读取文件以及同目录下的 .br、.gz 文件，没有预压缩的 gzip 文件时，
+// 会对可以缓存的可压缩文件动态压缩，压缩结果和原文件一起缓存
+func (s *StaticResourceHandler) load(name string) (*staticFile, error) {
+	if f, ok := s.cache.get(name); ok {
+		return f, nil
+	}
+	res, err := s.read(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, pc := range precompressed {
+		variant, err := s.read(name + pc.suffix)
+		// 不允许访问的压缩文件当作不存在，仍然返回原文件
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errorIsDir) || isPathError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		variant.encoding = pc.encoding
+		res.addVariant(variant)
+	}
+	head := res.data
+	if res.stream {
+		if head, err = s.head(name); err != nil {
+			return nil, err
+		}
+	}
+	res.contentType = s.contentType(name, head)
+	// 需要流式读取的文件只缓存大小、修改时间和 etag，不再动态压缩
+	if _, ok := res.variants["gzip"]; !ok && !res.stream && s.compressMinSize >= 0 &&
+		len(res.data) >= s.compressMinSize && compressible(res.contentType) {
+		variant, err := res.gzip()
+		if err != nil {
+			return nil, err
+		}
+		res.addVariant(variant)
+	}
+	s.cache.add(name, res)
+	return res, nil
+}
+
+// contentType 依次使用用户配置、mime.TypeByExtension 和内容嗅探确定类型，
+// 文本类型没有声明字符集时补充 charset
+func (s *StaticResourceHandler) contentType(name string, data []byte) string {
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	res, ok := s.extContentTypeMap[strings.ToLower(ext)]
+	if !ok && ext != "" {
+		res = mime.TypeByExtension("." + ext)
+	}
+	if res == "" {
+		res = http.DetectContentType(data)
+	}
+	mediaType, params, err := mime.ParseMediaType(res)
+	if err != nil || s.charset == "" || params["charset"] != "" || !textual(mediaType) {
+		return res
+	}
+	params["charset"] = s.charset
+	return mime.FormatMediaType(mediaType, params)
+}
+
+func (s *StaticResourceHandler) read(name string) (*staticFile, error) {
+	if err := s.checkSymlinks(name); err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(s.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, errorIsDir
+	}
+	if info.Size() > int64(s.maxSize) {
+		return s.streamFile(name, info)
+	}
+	data, err := fs.ReadFile(s.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	res := newStaticFile(data, info.ModTime())
+	res.name = name
+	return res, nil
+}
+
+// streamFile 创建不读入内存的 staticFile。embed.FS 等没有修改时间的文件只能计算内容的哈希作为 etag，
+// 计算时同样是流式读取，结果和元数据一起缓存，不会每次请求都重新计算
+func (s *StaticResourceHandler) streamFile(name string, info fs.FileInfo) (*staticFile, error) {
+	res := &staticFile{
+		name:    name,
+		stream:  true,
+		length:  info.Size(),
+		modTime: info.ModTime(),
+	}
+	if !res.modTime.IsZero() {
+		res.etag = fmt.Sprintf(`"%x-%x"`, res.modTime.UnixNano(), res.length)
+		return res, nil
+	}
+	file, err := s.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	res.etag = `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	return res, nil
+}
+
+// head 读取文件开头用于识别内容类型的部分
+func (s *StaticResourceHandler) head(name string) ([]byte, error) {
+	file, err := s.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// unchanged 检查缓存的文件以及预压缩文件是否被修改过，
+// 比较修改时间和大小，embed.FS 中的文件总是不变的
+func (s *StaticResourceHandler) unchanged(_ string, f *staticFile) bool {
+	if !f.unchanged(s.fs) {
+		return false
+	}
+	for _, variant := range f.variants {
+		if variant.name != "" && !variant.unchanged(s.fs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *staticFile) unchanged(fsys fs.FS) bool {
+	info, err := fs.Stat(fsys, f.name)
+	return err == nil && !info.IsDir() && info.ModTime().Equal(f.modTime) && info.Size() == f.length
+}
+
+// streamEntrySize 是流式读取的文件在缓存中占用的大小，这些文件只缓存元数据，
+// 按照固定的大小计算是为了让缓存的文件数同样受到容量限制
+const streamEntrySize = 512
+
+// size 是文件和所有压缩版本占用的字节数
+func (f *staticFile) size() int64 {
+	res := f.dataSize()
+	for _, variant := range f.variants {
+		res += variant.dataSize()
+	}
+	return res
+}
+
+func (f *staticFile) dataSize() int64 {
+	if f.stream {
+		return streamEntrySize
+	}
+	return int64(len(f.data))
+}
+
+func newStaticFile(data []byte, modTime time.Time) *staticFile {
+	sum := sha256.Sum256(data)
+	return &staticFile{
+		data:    data,
+		length:  int64(len(data)),
+		modTime: modTime,
+		etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}
+}
+
+func (f *staticFile) addVariant(variant *staticFile) {
+	if f.variants == nil {
+		f.variants = make(map[string]*staticFile, len(precompressed))
+	}
+	f.variants[variant.encoding] = variant
+}
+
+func (f *staticFile) gzip() (*staticFile, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(f.data); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	res := newStaticFile(buf.Bytes(), f.modTime)
+	res.encoding = "gzip"
+	return res, nil
+}
+
+// negotiate 按照 br、gzip 的顺序选择客户端可以接受的压缩版本，都不接受时返回原文件
+func (f *staticFile) negotiate(acceptEncoding string) *staticFile {
+	for _, pc := range precompressed {
+		variant, ok := f.variants[pc.encoding]
+		if ok && acceptsEncoding(acceptEncoding, pc.encoding) {
+			return variant
+		}
+	}
+	return f
+}
+
+// acceptsEncoding 解析 Accept-Encoding，q=0 表示明确拒绝，没有列出的编码按照 * 处理
+func acceptsEncoding(header string, encoding string) bool {
+	wildcard := false
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encoding && name != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range strings.Split(params, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.TrimSpace(key) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		if name == encoding {
+			return accepted
+		}
+		wildcard = accepted
+	}
+	return wildcard
+}
+
+// compressible 判断内容类型是否值得压缩，图片、视频等格式本身已经压缩过
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return textual(mediaType) || mediaType == "application/wasm"
+}
+
+// textual 判断媒体类型是否为文本，这些类型需要声明字符集
+func textual(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml",
+		"image/svg+xml", "application/manifest+json":
+		return true
+	default:
+		return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+	}
+}
+
+// notModified 优先使用 If-None-Match，没有时才使用 If-Modified-Since
+func (f *staticFile) notModified(req *http.Request) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, f.etag, false)
+	}
+	ims := req.Header.Get("If-Modified-Since")
+	if ims == "" || f.modTime.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !f.modTime.Truncate(time.Second).After(t)
+}
+
+// rangeApplies 检查 If-Range，文件已经变化时应该忽略 Range 返回整个文件
+func (f *staticFile) rangeApplies(req *http.Request) bool {
+	ir := req.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		return etagMatch(ir, f.etag, true)
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil || f.modTime.IsZero() {
+		return false
+	}
+	return f.modTime.Truncate(time.Second).Equal(t)
+}
+
+func (f *staticFile) serve(ctx *Context, contentType string) {
+	header := ctx.Resp.Header()
+	size := int64(len(f.data))
+	rangeHeader := ctx.Req.Header.Get("Range")
+	var (
+		ranges []httpRange
+		err    error
+	)
+	if rangeHeader != "" && f.rangeApplies(ctx.Req) {
+		ranges, err = parseRange(rangeHeader, size)
+	}
+	if errors.Is(err, errorNoOverlap) {
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		ctx.RespStatusCode = http.StatusRequestedRangeNotSatisfiable
+		ctx.RespData = []byte(http.StatusText(http.StatusRequestedRangeNotSatisfiable))
+		return
+	}
+	// 格式错误的 Range 直接忽略，多个范围的总长度超过文件大小时也返回整个文件
+	if err != nil || sumRangesSize(ranges) > size {
+		ranges = nil
+	}
+
+	switch len(ranges) {
+	case 0:
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = f.data
+	case 1:
+		ra := ranges[0]
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Range", ra.contentRange(size))
+		header.Set("Content-Length", strconv.FormatInt(ra.length, 10))
+		ctx.RespStatusCode = http.StatusPartialContent
+		ctx.RespData = f.data[ra.start : ra.start+ra.length]
+	default:
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, ra := range ranges {
+			part, _ := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {contentType},
+				"Content-Range": {ra.contentRange(size)},
+			})
+			_, _ = part.Write(f.data[ra.start : ra.start+ra.length])
+		}
+		_ = mw.Close()
+		header.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+		header.Set("Content-Length", strconv.Itoa(buf.Len()))
+		ctx.RespStatusCode = http.StatusPartialContent
+		ctx.RespData = buf.Bytes()
+	}
+}
+
+// etagMatch 比较逗号分隔的 etag 列表，strong 为 true 时弱 etag 永远不匹配
+func etagMatch(list string, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" && !strong {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange 解析形如 bytes=0-99,200-,-50 的 Range 头部，
+// 返回 errorNoOverlap 表示所有范围都不能满足
+func parseRange(s string, size int64) ([]httpRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return nil, errors.New("web: 无效的 range")
+	}
+	var (
+		ranges    []httpRange
+		noOverlap bool
+	)
+	for _, ra := range strings.Split(s[len(prefix):], ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		startStr, endStr, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, errors.New("web: 无效的 range")
+		}
+		startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+		var r httpRange
+		if startStr == "" {
+			// -N 表示最后 N 个字节
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("web: 无效的 range")
+			}
+			if n == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r.start, r.length = size-n, n
+		} else {
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errors.New("web: 无效的 range")
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			r.start = start
+			if endStr == "" {
+				r.length = size - start
+			} else {
+				end, err := strconv.ParseInt(endStr, 10, 64)
+				if err != nil || start > end {
+					return nil, errors.New("web: 无效的 range")
+				}
+				if end >= size {
+					end = size - 1
+				}
+				r.length = end - start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, errorNoOverlap
+	}
+	return ranges, nil
+}
+
+func sumRangesSize(ranges []httpRange) int64 {
+	var size int64
+	for _, ra := range ranges {
+		size += ra.length
+	}
+	return size
+}
+
+func StaticWithMaxFileSize(maxSize int) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.maxSize = maxSize
+	}
+}
+
+// StaticWithCacheSize 设置缓存占用的最大字节数，包括压缩版本，默认为 64MB
+func StaticWithCacheSize(size int64) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.cacheSize = size
+	}
+}
+
+// StaticWithCacheTTL 设置文件在缓存中保存的最长时间，默认为 0，表示不会因为时间过期
+func StaticWithCacheTTL(ttl time.Duration) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.cacheTTL = ttl
+	}
+}
+
+// StaticWithCheckInterval 设置命中缓存时检查文件是否变化的最小间隔，默认为 1s。
+// 为 0 时每次都检查，小于 0 时不检查，适合 embed.FS 等不会变化的文件
+func StaticWithCheckInterval(interval time.Duration) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.checkInterval = interval
+	}
+}
+
+// StaticWithMoreExtension 按扩展名设置 Content-Type，优先于自动识别的结果。
+// 扩展名可以带点也可以不带，例如 {"mjs": "text/javascript"}
+func StaticWithMoreExtension(extMap map[string]string) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		for ext, contextType := range extMap {
+			handler.extContentTypeMap[strings.ToLower(strings.TrimPrefix(ext, "."))] = contextType
+		}
+	}
+}
+
+// StaticWithCharset 设置文本类型默认的字符集，默认为 utf-8，为空时不添加
+func StaticWithCharset(charset string) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.charset = charset
+	}
+}
+
+// StaticWithCompression 设置动态 gzip 压缩的最小文件大小，默认为 1024，小于 0 表示关闭动态压缩。
+// 同目录下预先压缩好的 .br、.gz 文件不受影响
+func StaticWithCompression(minSize int) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.compressMinSize = minSize
+	}
+}
+
+// StaticWithPathPolicy 设置符号链接、隐藏文件以及允许和拒绝访问的路径，默认拒绝隐藏文件，
+// 只允许指向目录内部的符号链接。fs 不是本地目录时不检查符号链接
+func StaticWithPathPolicy(policy PathPolicy) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.policy = policy
+	}
+}
+
+// StaticWithIndexFiles 设置请求目录时依次查找的索引文件，默认为 index.html
+func StaticWithIndexFiles(names ...string) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.indexFiles = names
+	}
+}
+
+// StaticWithDirListing 设置没有索引文件的目录是否返回文件列表，默认返回 404
+func StaticWithDirListing(enabled bool) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.dirListing = enabled
+	}
+}
+
+// StaticWithCacheControl 按扩展名（不带点）设置 Cache-Control，
+// 例如 {"js": "public, max-age=31536000, immutable", "*": "no-cache"}，* 对应其余的扩展名
+func StaticWithCacheControl(policies map[string]string) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		for ext, policy := range policies {
+			handler.cacheControl[ext] = policy
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package web_frame
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StaticCacheStats 是静态文件缓存的统计数据，计数从创建 StaticResourceHandler 开始累计
+type StaticCacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Evictions 是因为超出容量被淘汰的文件数
+	Evictions int64 `json:"evictions"`
+	// Invalidations 是因为过期或者文件发生变化被删除的文件数
+	Invalidations int64 `json:"invalidations"`
+	Entries       int   `json:"entries"`
+	Bytes         int64 `json:"bytes"`
+}
+
+// staticCache 是按照字节数限制容量的 LRU 缓存。
+// 文件和它的所有压缩版本作为一个整体计算大小
+type staticCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	// ttl 为 0 时缓存不会因为时间过期
+	ttl time.Duration
+	// checkInterval 是两次检查文件是否变化的最小间隔，小于 0 时不检查
+	checkInterval time.Duration
+	// validate 在锁外执行，返回 false 表示文件已经变化
+	validate func(key string, f *staticFile) bool
+	ll       *list.List
+	items    map[string]*list.Element
+	now      func() time.Time
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	evictions     atomic.Int64
+	invalidations atomic.Int64
+}
+
+type staticCacheEntry struct {
+	key       string
+	file      *staticFile
+	size      int64
+	expiresAt time.Time
+	checkedAt time.Time
+}
+
+func newStaticCache(maxBytes int64, ttl time.Duration, checkInterval time.Duration,
+	validate func(key string, f *staticFile) bool) *staticCache {
+	return &staticCache{
+		maxBytes:      maxBytes,
+		ttl:           ttl,
+		checkInterval: checkInterval,
+		validate:      validate,
+		ll:            list.New(),
+		items:         make(map[string]*list.Element),
+		now:           time.Now,
+	}
+}
+
+func (c *staticCache) get(key string) (*staticFile, bool) {
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+	e := elem.Value.(*staticCacheEntry)
+	now := c.now()
+	if c.ttl > 0 && now.After(e.expiresAt) {
+		c.removeElement(elem)
+		c.mu.Unlock()
+		c.invalidations.Add(1)
+		c.misses.Add(1)
+		return nil, false
+	}
+	// 先更新检查时间，并发的请求不会同时去检查同一个文件
+	check := c.validate != nil && c.checkInterval >= 0 && now.Sub(e.checkedAt) >= c.checkInterval
+	if check {
+		e.checkedAt = now
+	}
+	c.ll.MoveToFront(elem)
+	c.mu.Unlock()
+
+	if check && !c.validate(key, e.file) {
+		c.mu.Lock()
+		if cur, ok := c.items[key]; ok && cur == elem {
+			c.removeElement(elem)
+		}
+		c.mu.Unlock()
+		c.invalidations.Add(1)
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return e.file, true
+}
+
+// add 放入文件，超过容量时从最久没有使用的文件开始淘汰，单个文件超过总容量时不缓存
+func (c *staticCache) add(key string, f *staticFile) {
+	size := f.size()
+	if size > c.maxBytes {
+		return
+	}
+	now := c.now()
+	e := &staticCacheEntry{
+		key:       key,
+		file:      f,
+		size:      size,
+		expiresAt: now.Add(c.ttl),
+		checkedAt: now,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *staticCache) removeElement(elem *list.Element) {
+	e := c.ll.Remove(elem).(*staticCacheEntry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+func (c *staticCache) stats() StaticCacheStats {
+	c.mu.Lock()
+	entries, bytes := c.ll.Len(), c.bytes
+	c.mu.Unlock()
+	return StaticCacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Evictions:     c.evictions.Load(),
+		Invalidations: c.invalidations.Load(),
+		Entries:       entries,
+		Bytes:         bytes,
+	}
+}
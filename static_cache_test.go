@@ -0,0 +1,95 @@
+package web_frame
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticCache_Evict(t *testing.T) {
+	c := newStaticCache(10, 0, -1, nil)
+	c.add("a", newStaticFile([]byte("aaaa"), time.Time{}))
+	c.add("b", newStaticFile([]byte("bbbb"), time.Time{}))
+	_, ok := c.get("a")
+	require.True(t, ok)
+
+	// a 刚被访问过，淘汰的是 b
+	c.add("c", newStaticFile([]byte("cccc"), time.Time{}))
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	_, ok = c.get("a")
+	assert.True(t, ok)
+
+	// 超过总容量的文件不缓存
+	c.add("d", newStaticFile([]byte(strings.Repeat("d", 11)), time.Time{}))
+	_, ok = c.get("d")
+	assert.False(t, ok)
+
+	// 压缩版本也计算在内，放入 e 之后淘汰 c
+	f := newStaticFile([]byte("eeee"), time.Time{})
+	f.addVariant(&staticFile{encoding: "gzip", data: []byte("ee")})
+	c.add("e", f)
+	_, ok = c.get("c")
+	assert.False(t, ok)
+
+	assert.Equal(t, StaticCacheStats{
+		Hits:      2,
+		Misses:    3,
+		Evictions: 2,
+		Entries:   2,
+		Bytes:     10,
+	}, c.stats())
+}
+
+func TestStaticCache_TTL(t *testing.T) {
+	now := time.Now()
+	c := newStaticCache(10, time.Minute, -1, nil)
+	c.now = func() time.Time { return now }
+	c.add("a", newStaticFile([]byte("a"), time.Time{}))
+
+	now = now.Add(time.Minute)
+	_, ok := c.get("a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = c.get("a")
+	assert.False(t, ok)
+	stats := c.stats()
+	assert.Equal(t, int64(1), stats.Invalidations)
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, int64(0), stats.Bytes)
+}
+
+func TestStaticCache_CheckInterval(t *testing.T) {
+	now := time.Now()
+	valid, checks := true, 0
+	c := newStaticCache(10, 0, time.Second, func(key string, f *staticFile) bool {
+		checks++
+		return valid
+	})
+	c.now = func() time.Time { return now }
+	c.add("a", newStaticFile([]byte("a"), time.Time{}))
+
+	_, ok := c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 0, checks)
+
+	now = now.Add(time.Second)
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, checks)
+
+	// 间隔内不会重复检查
+	valid = false
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, checks)
+
+	now = now.Add(time.Second)
+	_, ok = c.get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 2, checks)
+	assert.Equal(t, int64(1), c.stats().Invalidations)
+}
@@ -0,0 +1,825 @@
+package web_frame
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"embed"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func newStaticServer(t *testing.T, opts ...StaticResourceHandlerOption) *HTTPServer {
+	h, err := NewStaticResourceHandler(filepath.Join("testdata", "static"), opts...)
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static/:file", h.Handle)
+	return server
+}
+
+func TestStaticResourceHandler_Conditional(t *testing.T) {
+	server := newStaticServer(t, StaticWithCacheControl(map[string]string{
+		"js": "public, max-age=31536000",
+		"*":  "no-cache",
+	}))
+	info, err := os.Stat(filepath.Join("testdata", "static", "my.js"))
+	require.NoError(t, err)
+	lastModified := info.ModTime().UTC().Format(http.TimeFormat)
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/my.js", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "let a = 123", resp.Body.String())
+	etag := resp.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+	assert.Equal(t, lastModified, resp.Header().Get("Last-Modified"))
+	assert.Equal(t, "bytes", resp.Header().Get("Accept-Ranges"))
+	assert.Equal(t, "public, max-age=31536000", resp.Header().Get("Cache-Control"))
+
+	testCases := []struct {
+		name     string
+		header   map[string]string
+		wantCode int
+	}{
+		{
+			name:     "etag match",
+			header:   map[string]string{"If-None-Match": `"other", ` + etag},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "weak etag match",
+			header:   map[string]string{"If-None-Match": "W/" + etag},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "etag mismatch",
+			header:   map[string]string{"If-None-Match": `"other"`},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "etag takes precedence",
+			header: map[string]string{
+				"If-None-Match":     `"other"`,
+				"If-Modified-Since": lastModified,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "not modified since",
+			header:   map[string]string{"If-Modified-Since": lastModified},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "modified since",
+			header:   map[string]string{"If-Modified-Since": info.ModTime().Add(-time.Hour).UTC().Format(http.TimeFormat)},
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/static/my.js", nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+			assert.Equal(t, etag, resp.Header().Get("ETag"))
+			if tc.wantCode == http.StatusNotModified {
+				assert.Empty(t, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestStaticResourceHandler_Range(t *testing.T) {
+	server := newStaticServer(t)
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/my.js", nil))
+	etag := resp.Header().Get("ETag")
+
+	testCases := []struct {
+		name      string
+		header    map[string]string
+		wantCode  int
+		wantBody  string
+		wantRange string
+	}{
+		{
+			name:      "single range",
+			header:    map[string]string{"Range": "bytes=0-2"},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "let",
+			wantRange: "bytes 0-2/11",
+		},
+		{
+			name:      "open ended",
+			header:    map[string]string{"Range": "bytes=8-"},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "123",
+			wantRange: "bytes 8-10/11",
+		},
+		{
+			name:      "suffix",
+			header:    map[string]string{"Range": "bytes=-3"},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "123",
+			wantRange: "bytes 8-10/11",
+		},
+		{
+			name:      "end beyond size",
+			header:    map[string]string{"Range": "bytes=4-100"},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "a = 123",
+			wantRange: "bytes 4-10/11",
+		},
+		{
+			name:      "unsatisfiable",
+			header:    map[string]string{"Range": "bytes=20-30"},
+			wantCode:  http.StatusRequestedRangeNotSatisfiable,
+			wantRange: "bytes */11",
+		},
+		{
+			name:     "malformed",
+			header:   map[string]string{"Range": "lines=1-2"},
+			wantCode: http.StatusOK,
+			wantBody: "let a = 123",
+		},
+		{
+			name:      "if-range match",
+			header:    map[string]string{"Range": "bytes=0-2", "If-Range": etag},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "let",
+			wantRange: "bytes 0-2/11",
+		},
+		{
+			name:     "if-range mismatch",
+			header:   map[string]string{"Range": "bytes=0-2", "If-Range": `"other"`},
+			wantCode: http.StatusOK,
+			wantBody: "let a = 123",
+		},
+		{
+			name:     "if-range weak etag",
+			header:   map[string]string{"Range": "bytes=0-2", "If-Range": "W/" + etag},
+			wantCode: http.StatusOK,
+			wantBody: "let a = 123",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/static/my.js", nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+			assert.Equal(t, tc.wantRange, resp.Header().Get("Content-Range"))
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestStaticResourceHandler_MultipartRange(t *testing.T) {
+	server := newStaticServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/static/my.js", nil)
+	req.Header.Set("Range", "bytes=0-2, -3")
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusPartialContent, resp.Code)
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+	mr := multipart.NewReader(strings.NewReader(resp.Body.String()), params["boundary"])
+	var ranges, bodies []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		ranges = append(ranges, part.Header.Get("Content-Range"))
+		bodies = append(bodies, string(data))
+	}
+	assert.Equal(t, []string{"bytes 0-2/11", "bytes 8-10/11"}, ranges)
+	assert.Equal(t, []string{"let", "123"}, bodies)
+}
+
+func TestStaticResourceHandler_NotFound(t *testing.T) {
+	server := newStaticServer(t)
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/missing.js", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestStaticResourceHandler_Compression(t *testing.T) {
+	dir := t.TempDir()
+	css := strings.Repeat("body { margin: 0; }\n", 100)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.css"), []byte(css), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "small.css"), []byte("a{}"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logo.png"), []byte(css), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.txt"), []byte("raw"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.txt.br"), []byte("brotli"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.txt.gz"), []byte("gzip"), 0o644))
+
+	h, err := NewStaticResourceHandler(dir, StaticWithMoreExtension(map[string]string{
+		"css": "text/css; charset=utf-8",
+		"txt": "text/plain; charset=utf-8",
+	}))
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static/:file", h.Handle)
+
+	testCases := []struct {
+		name           string
+		file           string
+		acceptEncoding string
+		wantEncoding   string
+		wantVary       bool
+		wantBody       string
+	}{
+		{
+			name:           "precompressed br",
+			file:           "app.txt",
+			acceptEncoding: "gzip, deflate, br",
+			wantEncoding:   "br",
+			wantVary:       true,
+			wantBody:       "brotli",
+		},
+		{
+			name:           "precompressed gzip",
+			file:           "app.txt",
+			acceptEncoding: "gzip, br;q=0",
+			wantEncoding:   "gzip",
+			wantVary:       true,
+			wantBody:       "gzip",
+		},
+		{
+			name:           "wildcard",
+			file:           "app.txt",
+			acceptEncoding: "*",
+			wantEncoding:   "br",
+			wantVary:       true,
+			wantBody:       "brotli",
+		},
+		{
+			name:     "identity",
+			file:     "app.txt",
+			wantVary: true,
+			wantBody: "raw",
+		},
+		{
+			name:           "on the fly gzip",
+			file:           "app.css",
+			acceptEncoding: "gzip",
+			wantEncoding:   "gzip",
+			wantVary:       true,
+			wantBody:       css,
+		},
+		{
+			name:           "gzip refused",
+			file:           "app.css",
+			acceptEncoding: "gzip;q=0, br",
+			wantVary:       true,
+			wantBody:       css,
+		},
+		{
+			name:           "too small",
+			file:           "small.css",
+			acceptEncoding: "gzip",
+			wantBody:       "a{}",
+		},
+		{
+			name:           "not compressible",
+			file:           "logo.png",
+			acceptEncoding: "gzip",
+			wantBody:       css,
+		},
+	}
+	etags := map[string]string{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/static/"+tc.file, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tc.wantEncoding, resp.Header().Get("Content-Encoding"))
+			if tc.wantVary {
+				assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"))
+			} else {
+				assert.Empty(t, resp.Header().Get("Vary"))
+			}
+			body := resp.Body.Bytes()
+			if tc.wantEncoding == "gzip" && tc.file == "app.css" {
+				gr, err := gzip.NewReader(bytes.NewReader(body))
+				require.NoError(t, err)
+				body, err = io.ReadAll(gr)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantBody, string(body))
+			etags[tc.file+"/"+tc.wantEncoding] = resp.Header().Get("ETag")
+		})
+	}
+	// 不同的编码对应不同的 ETag
+	assert.NotEqual(t, etags["app.txt/br"], etags["app.txt/gzip"])
+	assert.NotEqual(t, etags["app.txt/br"], etags["app.txt/"])
+	assert.NotEqual(t, etags["app.css/gzip"], etags["app.css/"])
+}
+
+//go:embed testdata/static
+var embedStatic embed.FS
+
+func TestStaticResourceHandler_Embed(t *testing.T) {
+	sub, err := fs.Sub(embedStatic, "testdata/static")
+	require.NoError(t, err)
+	h, err := NewStaticResourceHandlerFS(sub)
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static/:file", h.Handle)
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/my.js", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "let a = 123", resp.Body.String())
+	// embed.FS 没有修改时间，只能依赖 ETag
+	assert.Empty(t, resp.Header().Get("Last-Modified"))
+	etag := resp.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/static/my.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+}
+
+func TestStaticResourceHandler_Dir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":     {Data: []byte("home")},
+		"docs/guide.txt": {Data: []byte("guide")},
+		"docs/a b.txt":   {Data: []byte("space")},
+		"docs/sub/x.txt": {Data: []byte("x")},
+		"blog/main.html": {Data: []byte("blog")},
+	}
+	newServer := func(t *testing.T, opts ...StaticResourceHandlerOption) *HTTPServer {
+		h, err := NewStaticResourceHandlerFS(fsys, opts...)
+		require.NoError(t, err)
+		server := NewHTTPServer()
+		server.Get("/site", h.Handle)
+		server.Get("/site/:file", h.Handle)
+		return server
+	}
+
+	testCases := []struct {
+		name         string
+		opts         []StaticResourceHandlerOption
+		path         string
+		wantCode     int
+		wantLocation string
+		wantBody     []string
+	}{
+		{
+			name:         "redirect root",
+			path:         "/site?v=1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/site/?v=1",
+		},
+		{
+			name:     "root index",
+			path:     "/site/",
+			wantCode: http.StatusOK,
+			wantBody: []string{"home"},
+		},
+		{
+			name:         "redirect dir",
+			path:         "/site/docs",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/site/docs/",
+		},
+		{
+			name:     "custom index",
+			opts:     []StaticResourceHandlerOption{StaticWithIndexFiles("index.html", "main.html")},
+			path:     "/site/blog/",
+			wantCode: http.StatusOK,
+			wantBody: []string{"blog"},
+		},
+		{
+			name:     "listing disabled",
+			path:     "/site/docs/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "listing",
+			opts:     []StaticResourceHandlerOption{StaticWithDirListing(true)},
+			path:     "/site/docs/",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				`<a href="a%20b.txt">a b.txt</a>`,
+				`<a href="guide.txt">guide.txt</a>`,
+				`<a href="sub/">sub/</a>`,
+			},
+		},
+		{
+			name:     "file",
+			path:     "/site/index.html",
+			wantCode: http.StatusOK,
+			wantBody: []string{"home"},
+		},
+		{
+			name:     "dot dot",
+			path:     "/site/..",
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newServer(t, tc.opts...)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, resp.Code)
+			if tc.wantLocation != "" {
+				assert.Equal(t, tc.wantLocation, resp.Header().Get("Location"))
+			}
+			for _, want := range tc.wantBody {
+				assert.Contains(t, resp.Body.String(), want)
+			}
+		})
+	}
+}
+
+func TestStaticResourceHandler_Name(t *testing.T) {
+	h, err := NewStaticResourceHandlerFS(fstest.MapFS{})
+	require.NoError(t, err)
+	testCases := []struct {
+		file    string
+		want    string
+		wantErr error
+	}{
+		{file: "my.js", want: "my.js"},
+		{file: "/", want: "."},
+		{file: "a/./b//c", want: "a/b/c"},
+		{file: "../../etc/passwd", wantErr: errorInvalidPath},
+		{file: "..", wantErr: errorInvalidPath},
+		{file: `..\..\windows`, wantErr: errorInvalidPath},
+		{file: "a\x00b", wantErr: errorInvalidPath},
+		{file: ".env", wantErr: errorHiddenPath},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			name, err := h.name(&Context{PathParams: map[string]string{"file": tc.file}})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, name)
+		})
+	}
+}
+
+func TestStaticResourceHandler_ContentType(t *testing.T) {
+	fsys := fstest.MapFS{
+		"my.js":     {Data: []byte("let a = 123")},
+		"style.css": {Data: []byte("body {}")},
+		"doc.pdf":   {Data: []byte("%PDF-1.4")},
+		"data.json": {Data: []byte(`{"a":1}`)},
+		"LOGO.PNG":  {Data: []byte("\x89PNG\r\n\x1a\n")},
+		"LICENSE":   {Data: []byte("MIT License")},
+		"blob":      {Data: []byte{0x00, 0x01, 0x02, 0xff}},
+		"page.tpl":  {Data: []byte("<html></html>")},
+		"app.data":  {Data: []byte("custom")},
+	}
+	testCases := []struct {
+		name string
+		opts []StaticResourceHandlerOption
+		file string
+		want []string
+	}{
+		{
+			name: "javascript",
+			file: "my.js",
+			// 系统的 mime.types 可能把 js 注册为 application/javascript
+			want: []string{"text/javascript; charset=utf-8", "application/javascript; charset=utf-8"},
+		},
+		{
+			name: "css",
+			file: "style.css",
+			want: []string{"text/css; charset=utf-8"},
+		},
+		{
+			name: "pdf",
+			file: "doc.pdf",
+			want: []string{"application/pdf"},
+		},
+		{
+			name: "add charset",
+			file: "data.json",
+			want: []string{"application/json; charset=utf-8"},
+		},
+		{
+			name: "no charset",
+			opts: []StaticResourceHandlerOption{StaticWithCharset("")},
+			file: "data.json",
+			want: []string{"application/json"},
+		},
+		{
+			name: "upper case extension",
+			file: "LOGO.PNG",
+			want: []string{"image/png"},
+		},
+		{
+			name: "sniff text without extension",
+			file: "LICENSE",
+			want: []string{"text/plain; charset=utf-8"},
+		},
+		{
+			name: "sniff binary without extension",
+			file: "blob",
+			want: []string{"application/octet-stream"},
+		},
+		{
+			name: "sniff unknown extension",
+			file: "page.tpl",
+			want: []string{"text/html; charset=utf-8"},
+		},
+		{
+			name: "override",
+			opts: []StaticResourceHandlerOption{StaticWithMoreExtension(map[string]string{
+				".data": "application/x-custom",
+				"js":    "application/x-javascript",
+			})},
+			file: "app.data",
+			want: []string{"application/x-custom"},
+		},
+		{
+			name: "override known extension",
+			opts: []StaticResourceHandlerOption{StaticWithMoreExtension(map[string]string{
+				"js": "application/x-javascript",
+			})},
+			file: "my.js",
+			want: []string{"application/x-javascript"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := NewStaticResourceHandlerFS(fsys, tc.opts...)
+			require.NoError(t, err)
+			server := NewHTTPServer()
+			server.Get("/static/:file", h.Handle)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/"+tc.file, nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Contains(t, tc.want, resp.Header().Get("Content-Type"))
+			assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"))
+		})
+	}
+}
+
+func TestStaticResourceHandler_CacheInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.txt")
+	require.NoError(t, os.WriteFile(file, []byte("v1"), 0o644))
+	h, err := NewStaticResourceHandler(dir, StaticWithCheckInterval(0))
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static/:file", h.Handle)
+	get := func() string {
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/app.txt", nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+		return resp.Body.String()
+	}
+
+	assert.Equal(t, "v1", get())
+	assert.Equal(t, "v1", get())
+	stats := h.CacheStats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, int64(2), stats.Bytes)
+
+	require.NoError(t, os.WriteFile(file, []byte("v2 changed"), 0o644))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Hour)))
+	assert.Equal(t, "v2 changed", get())
+	stats = h.CacheStats()
+	assert.Equal(t, int64(1), stats.Invalidations)
+	assert.Equal(t, int64(10), stats.Bytes)
+
+	// 文件被删除后不再返回缓存的内容
+	require.NoError(t, os.Remove(file))
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/app.txt", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestStaticResourceHandler_CacheSize(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.bin": {Data: []byte(strings.Repeat("a", 6))},
+		"b.bin": {Data: []byte(strings.Repeat("b", 6))},
+	}
+	h, err := NewStaticResourceHandlerFS(fsys, StaticWithCacheSize(10))
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static/:file", h.Handle)
+	for _, file := range []string{"a.bin", "b.bin", "a.bin"} {
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/"+file, nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+	}
+	stats := h.CacheStats()
+	assert.Equal(t, int64(3), stats.Misses)
+	assert.Equal(t, int64(2), stats.Evictions)
+	assert.Equal(t, int64(6), stats.Bytes)
+}
+
+func TestStaticResourceHandler_Stream(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("0123456789", 10)
+	file := filepath.Join(dir, "big.txt")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	h, err := NewStaticResourceHandler(dir, StaticWithMaxFileSize(16))
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static/:file", h.Handle)
+
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/big.txt", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, content, resp.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header().Get("Content-Type"))
+	etag := resp.Header().Get("ETag")
+	assert.Equal(t, fmt.Sprintf(`"%x-64"`, info.ModTime().UnixNano()), etag)
+
+	testCases := []struct {
+		name      string
+		header    map[string]string
+		wantCode  int
+		wantBody  string
+		wantRange string
+	}{
+		{
+			name:      "range",
+			header:    map[string]string{"Range": "bytes=10-14"},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "01234",
+			wantRange: "bytes 10-14/100",
+		},
+		{
+			name:      "if-range match",
+			header:    map[string]string{"Range": "bytes=-3", "If-Range": etag},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "789",
+			wantRange: "bytes 97-99/100",
+		},
+		{
+			name:     "if-range mismatch",
+			header:   map[string]string{"Range": "bytes=-3", "If-Range": `"other"`},
+			wantCode: http.StatusOK,
+			wantBody: content,
+		},
+		{
+			name:      "unsatisfiable",
+			header:    map[string]string{"Range": "bytes=200-"},
+			wantCode:  http.StatusRequestedRangeNotSatisfiable,
+			wantRange: "bytes */100",
+		},
+		{
+			name:     "not modified",
+			header:   map[string]string{"If-None-Match": etag},
+			wantCode: http.StatusNotModified,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/static/big.txt", nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+			assert.Equal(t, tc.wantRange, resp.Header().Get("Content-Range"))
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, resp.Body.String())
+			}
+		})
+	}
+
+	// 大文件只缓存元数据
+	stats := h.CacheStats()
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, int64(streamEntrySize), stats.Bytes)
+}
+
+// countingFS 记录每个文件被打开的次数
+type countingFS struct {
+	fs.FS
+	opens map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opens[name]++
+	return c.FS.Open(name)
+}
+
+func TestStaticResourceHandler_StreamNoModTime(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	fsys := &countingFS{
+		FS:    fstest.MapFS{"big.txt": {Data: []byte(content)}},
+		opens: map[string]int{},
+	}
+	h, err := NewStaticResourceHandlerFS(fsys, StaticWithMaxFileSize(16))
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static/:file", h.Handle)
+
+	var etags []string
+	for i := 0; i < 3; i++ {
+		before := fsys.opens["big.txt"]
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/big.txt", nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, content, resp.Body.String())
+		etags = append(etags, resp.Header().Get("ETag"))
+		if i > 0 {
+			// 命中缓存之后不再计算哈希，只打开一次用于输出
+			assert.Equal(t, 1, fsys.opens["big.txt"]-before)
+		}
+	}
+	sum := sha256.Sum256([]byte(content))
+	assert.Equal(t, `"`+hex.EncodeToString(sum[:16])+`"`, etags[0])
+	assert.Equal(t, etags[0], etags[2])
+}
+
+func TestStaticResourceHandler_PathPolicy(t *testing.T) {
+	base := newPolicyTree(t)
+	// 索引文件和预压缩文件同样不能通过符号链接指向根目录之外
+	require.NoError(t, os.Mkdir(filepath.Join(base, "d"), 0o755))
+	require.NoError(t, os.Symlink(filepath.Join("..", "..", "secret.txt"), filepath.Join(base, "d", "index.html")))
+	require.NoError(t, os.Symlink(filepath.Join("..", "secret.txt"), filepath.Join(base, "public.txt.gz")))
+	h, err := NewStaticResourceHandler(base, StaticWithDirListing(true),
+		StaticWithPathPolicy(PathPolicy{Deny: []string{"node_modules"}}))
+	require.NoError(t, err)
+	server := NewHTTPServer()
+	server.Get("/static", h.Handle)
+	server.Get("/static/:file", h.Handle)
+
+	testCases := []struct {
+		path     string
+		wantCode int
+	}{
+		{path: "/static/public.txt", wantCode: http.StatusOK},
+		{path: "/static/link-inside", wantCode: http.StatusOK},
+		{path: "/static/link-outside", wantCode: http.StatusForbidden},
+		{path: "/static/.env", wantCode: http.StatusNotFound},
+		{path: "/static/node_modules/", wantCode: http.StatusForbidden},
+		{path: "/static/..", wantCode: http.StatusForbidden},
+		{path: "/static/d/", wantCode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, resp.Code)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/static/public.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("Content-Encoding"))
+	assert.Equal(t, "base/public.txt", resp.Body.String())
+
+	// 目录列表中不包含不能访问的文件
+	resp = httptest.NewRecorder()
+	server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/static/", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	body := resp.Body.String()
+	assert.Contains(t, body, "public.txt")
+	assert.Contains(t, body, "assets/")
+	assert.NotContains(t, body, ".env")
+	assert.NotContains(t, body, ".git")
+	assert.NotContains(t, body, "node_modules")
+}